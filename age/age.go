@@ -0,0 +1,178 @@
+// Package age implements the age v1 file encryption format
+// (https://age-encryption.org/v1) with X25519 recipients derived from
+// key25519 key pairs and scrypt passphrases. Files it writes can be
+// decrypted with the reference age tool and vice versa.
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const fileKeySize = 16
+const streamNonceSize = 16
+
+var (
+	// ErrIncorrectIdentity is returned by Identity.Unwrap when none of the
+	// stanzas are addressed to the identity.
+	ErrIncorrectIdentity = errors.New("age: incorrect identity for recipient block")
+	ErrNoIdentityMatch   = errors.New("age: no identity matched any of the recipients")
+)
+
+// Recipient wraps a file key for one recipient in one or more stanzas.
+type Recipient interface {
+	Wrap(fileKey []byte) ([]*Stanza, error)
+}
+
+// Identity unwraps the file key from the stanzas addressed to it, returning
+// ErrIncorrectIdentity if there are none.
+type Identity interface {
+	Unwrap(stanzas []*Stanza) ([]byte, error)
+}
+
+// Encrypt writes the age header for recipients to dst and returns a writer
+// for the plaintext. Close must be called to write the final chunk; it does
+// not close dst.
+func Encrypt(dst io.Writer, recipients ...Recipient) (io.WriteCloser, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("age: no recipients specified")
+	}
+
+	fileKey := make([]byte, fileKeySize)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	hdr := &header{}
+	for i, r := range recipients {
+		stanzas, err := r.Wrap(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("age: failed to wrap key for recipient #%d: %w", i, err)
+		}
+		for _, s := range stanzas {
+			if s.Type == "scrypt" && len(recipients) != 1 {
+				return nil, errors.New("age: an scrypt recipient must be the only one")
+			}
+		}
+		hdr.Recipients = append(hdr.Recipients, stanzas...)
+	}
+
+	mac, err := headerMAC(fileKey, hdr)
+	if err != nil {
+		return nil, err
+	}
+	hdr.MAC = mac
+	if err := hdr.marshal(dst); err != nil {
+		return nil, fmt.Errorf("age: failed to write header: %w", err)
+	}
+
+	nonce := make([]byte, streamNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(nonce); err != nil {
+		return nil, fmt.Errorf("age: failed to write nonce: %w", err)
+	}
+
+	payloadKey, err := streamKey(fileKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamWriter(payloadKey, dst)
+}
+
+// Decrypt reads the age header from src, unwraps the file key with the first
+// matching identity and returns a reader for the plaintext. The payload is
+// authenticated chunk by chunk as it is read.
+func Decrypt(src io.Reader, identities ...Identity) (io.Reader, error) {
+	if len(identities) == 0 {
+		return nil, errors.New("age: no identities specified")
+	}
+
+	rr := bufio.NewReader(src)
+	hdr, err := parseHeader(rr)
+	if err != nil {
+		return nil, err
+	}
+
+	var fileKey []byte
+	for _, id := range identities {
+		fileKey, err = id.Unwrap(hdr.Recipients)
+		if errors.Is(err, ErrIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		break
+	}
+	if fileKey == nil {
+		return nil, ErrNoIdentityMatch
+	}
+
+	mac, err := headerMAC(fileKey, hdr)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(mac, hdr.MAC) {
+		return nil, errors.New("age: bad header MAC")
+	}
+
+	nonce := make([]byte, streamNonceSize)
+	if _, err := io.ReadFull(rr, nonce); err != nil {
+		return nil, fmt.Errorf("age: failed to read nonce: %w", err)
+	}
+
+	payloadKey, err := streamKey(fileKey, nonce)
+	if err != nil {
+		return nil, err
+	}
+	return newStreamReader(payloadKey, rr)
+}
+
+// multiUnwrap tries unwrap on every stanza, skipping the ones that belong to
+// other identities.
+func multiUnwrap(unwrap func(*Stanza) ([]byte, error), stanzas []*Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		fileKey, err := unwrap(s)
+		if errors.Is(err, ErrIncorrectIdentity) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return fileKey, nil
+	}
+	return nil, ErrIncorrectIdentity
+}
+
+func headerMAC(fileKey []byte, hdr *header) ([]byte, error) {
+	hmacKey := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nil, []byte("header")), hmacKey); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := hdr.marshalWithoutMAC(&buf); err != nil {
+		return nil, err
+	}
+	h := hmac.New(sha256.New, hmacKey)
+	h.Write(buf.Bytes())
+	return h.Sum(nil), nil
+}
+
+func streamKey(fileKey, nonce []byte) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, fileKey, nonce, []byte("payload")), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
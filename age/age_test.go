@@ -0,0 +1,209 @@
+package age
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/lyonnee/key25519"
+)
+
+// The files in testdata were encrypted with the reference implementation,
+// filippo.io/age v1.1.1, to testIdentity or, for scrypt.age, to
+// testPassphrase with work factor 10.
+const (
+	testIdentity   = "AGE-SECRET-KEY-1R05XW5QART7LDHJJDCDQ34XR0PRCSK8ZXSV955FKGMLG94AA05HQ3RZU3N"
+	testPassphrase = "correct horse battery staple"
+	testMessage    = "hello from age\n"
+)
+
+// chunkPayload is the plaintext of testdata/chunk.age: exactly one full
+// 64 KiB chunk.
+func chunkPayload() []byte {
+	p := make([]byte, chunkSize)
+	for i := range p {
+		p[i] = byte(i % 251)
+	}
+	return p
+}
+
+func decryptFile(t *testing.T, name string, identities ...Identity) []byte {
+	t.Helper()
+	f, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := Decrypt(f, identities...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func encrypt(t *testing.T, msg []byte, recipients ...Recipient) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := Encrypt(&buf, recipients...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecryptReferenceFiles(t *testing.T) {
+	id, err := ParseX25519Identity(testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file string
+		want []byte
+	}{
+		{"testdata/x25519.age", []byte(testMessage)},
+		{"testdata/empty.age", nil},
+		{"testdata/chunk.age", chunkPayload()},
+	}
+	for _, tt := range tests {
+		if got := decryptFile(t, tt.file, id); !bytes.Equal(got, tt.want) {
+			t.Errorf("%s: decrypted %d bytes, want %d", tt.file, len(got), len(tt.want))
+		}
+	}
+}
+
+func TestDecryptReferenceScrypt(t *testing.T) {
+	id, err := NewScryptIdentity(testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decryptFile(t, "testdata/scrypt.age", id); string(got) != testMessage {
+		t.Fatalf("decrypted %q, want %q", got, testMessage)
+	}
+
+	wrong, err := NewScryptIdentity("wrong passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open("testdata/scrypt.age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := Decrypt(f, wrong); err == nil {
+		t.Fatal("decrypted with the wrong passphrase")
+	}
+}
+
+func TestChunkBoundaries(t *testing.T) {
+	id, err := IdentityFromKeyPair(key25519.NewKeyPair())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize} {
+		msg := bytes.Repeat([]byte{0x5a}, size)
+		enc := encrypt(t, msg, id.Recipient())
+
+		r, err := Decrypt(bytes.NewReader(enc), id)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: %v", size, err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("size %d: round trip mismatch", size)
+		}
+	}
+}
+
+func TestFullChunkMatchesReference(t *testing.T) {
+	// A payload of exactly one chunk is a single final chunk, with no empty
+	// chunk after it. Both files have one X25519 stanza, so their headers
+	// have the same length.
+	ref, err := os.ReadFile("testdata/chunk.age")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := ParseX25519Identity(testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enc := encrypt(t, chunkPayload(), id.Recipient()); len(enc) != len(ref) {
+		t.Fatalf("encrypted length = %d, reference = %d", len(enc), len(ref))
+	}
+}
+
+func TestTruncatedPayload(t *testing.T) {
+	id, err := ParseX25519Identity(testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := os.ReadFile("testdata/chunk.age")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := Decrypt(bytes.NewReader(ref[:len(ref)-1]), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); err == nil {
+		t.Fatal("truncated payload decrypted without error")
+	}
+}
+
+func TestScryptRecipient(t *testing.T) {
+	r, err := NewScryptRecipient(testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetWorkFactor(10)
+	enc := encrypt(t, []byte(testMessage), r)
+
+	id, err := NewScryptIdentity(testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := Decrypt(bytes.NewReader(enc), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := io.ReadAll(out); string(got) != testMessage {
+		t.Fatalf("decrypted %q, want %q", got, testMessage)
+	}
+
+	id.SetMaxWorkFactor(9)
+	if _, err := Decrypt(bytes.NewReader(enc), id); err == nil {
+		t.Fatal("accepted a work factor above the maximum")
+	}
+}
+
+func TestScryptRecipientMustBeAlone(t *testing.T) {
+	r, err := NewScryptRecipient(testPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.SetWorkFactor(10)
+	id, err := ParseX25519Identity(testIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Encrypt(io.Discard, r, id.Recipient()); err == nil {
+		t.Fatal("Encrypt accepted an scrypt recipient alongside another one")
+	}
+}
@@ -0,0 +1,183 @@
+package age
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	intro          = "age-encryption.org/v1\n"
+	stanzaPrefix   = "->"
+	footerPrefix   = "---"
+	columnsPerLine = 64
+	bytesPerLine   = columnsPerLine / 4 * 3
+)
+
+var b64 = base64.RawStdEncoding.Strict()
+
+// Stanza is a recipient stanza of an age header.
+type Stanza struct {
+	Type string
+	Args []string
+	Body []byte
+}
+
+type header struct {
+	Recipients []*Stanza
+	MAC        []byte
+}
+
+func (s *Stanza) marshal(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "%s %s", stanzaPrefix, s.Type); err != nil {
+		return err
+	}
+	for _, a := range s.Args {
+		if _, err := fmt.Fprintf(w, " %s", a); err != nil {
+			return err
+		}
+	}
+	if _, err := io.WriteString(w, "\n"); err != nil {
+		return err
+	}
+
+	body := b64.EncodeToString(s.Body)
+	for len(body) >= columnsPerLine {
+		if _, err := io.WriteString(w, body[:columnsPerLine]+"\n"); err != nil {
+			return err
+		}
+		body = body[columnsPerLine:]
+	}
+	// The body always ends with a short, possibly empty, line.
+	_, err := io.WriteString(w, body+"\n")
+	return err
+}
+
+// marshalWithoutMAC writes the header up to and including the footer
+// prefix, which is the input of the header MAC.
+func (h *header) marshalWithoutMAC(w io.Writer) error {
+	if _, err := io.WriteString(w, intro); err != nil {
+		return err
+	}
+	for _, r := range h.Recipients {
+		if err := r.marshal(w); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, footerPrefix)
+	return err
+}
+
+func (h *header) marshal(w io.Writer) error {
+	if err := h.marshalWithoutMAC(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, " %s\n", b64.EncodeToString(h.MAC))
+	return err
+}
+
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string { return "age: parsing header: " + e.err.Error() }
+func (e *parseError) Unwrap() error { return e.err }
+
+func errorf(format string, a ...interface{}) error {
+	return &parseError{fmt.Errorf(format, a...)}
+}
+
+// parseHeader reads a header from r, leaving r positioned at the payload.
+func parseHeader(r *bufio.Reader) (*header, error) {
+	h := &header{}
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, errorf("failed to read intro: %w", err)
+	}
+	if line != intro {
+		return nil, errorf("unexpected intro: %q", line)
+	}
+
+	var s *Stanza
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, errorf("failed to read header: %w", err)
+		}
+
+		if s != nil {
+			b, err := decodeBodyLine(line)
+			if err != nil {
+				return nil, err
+			}
+			s.Body = append(s.Body, b...)
+			if len(b) < bytesPerLine {
+				h.Recipients = append(h.Recipients, s)
+				s = nil
+			}
+			continue
+		}
+
+		if bytes.HasPrefix(line, []byte(footerPrefix)) {
+			prefix, args := splitArgs(line)
+			if prefix != footerPrefix || len(args) != 1 {
+				return nil, errorf("malformed closing line: %q", line)
+			}
+			h.MAC, err = b64.DecodeString(args[0])
+			if err != nil || len(h.MAC) != 32 {
+				return nil, errorf("malformed closing line %q: %v", line, err)
+			}
+			break
+		}
+
+		if !bytes.HasPrefix(line, []byte(stanzaPrefix)) {
+			return nil, errorf("unexpected line: %q", line)
+		}
+		prefix, args := splitArgs(line)
+		if prefix != stanzaPrefix || len(args) < 1 {
+			return nil, errorf("malformed recipient: %q", line)
+		}
+		for _, a := range args {
+			if !isValidString(a) {
+				return nil, errorf("malformed recipient: %q", line)
+			}
+		}
+		s = &Stanza{Type: args[0], Args: args[1:]}
+	}
+
+	return h, nil
+}
+
+func splitArgs(line []byte) (string, []string) {
+	l := strings.TrimSuffix(string(line), "\n")
+	parts := strings.Split(l, " ")
+	return parts[0], parts[1:]
+}
+
+func isValidString(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for _, c := range s {
+		if c < 33 || c > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+func decodeBodyLine(line []byte) ([]byte, error) {
+	l := bytes.TrimSuffix(line, []byte("\n"))
+	if len(l) > columnsPerLine {
+		return nil, errorf("body line too long: %q", line)
+	}
+	b, err := b64.DecodeString(string(l))
+	if err != nil {
+		return nil, errorf("malformed body line %q: %w", line, err)
+	}
+	return b, nil
+}
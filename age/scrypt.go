@@ -0,0 +1,136 @@
+package age
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const scryptLabel = "age-encryption.org/v1/scrypt"
+
+// DefaultScryptWorkFactor is the log2 of the scrypt N parameter used when
+// encrypting with a passphrase, matching the reference implementation.
+const DefaultScryptWorkFactor = 18
+
+// ScryptRecipient encrypts to a passphrase. It must be the only recipient
+// of a file.
+type ScryptRecipient struct {
+	password   []byte
+	workFactor int
+}
+
+func NewScryptRecipient(password string) (*ScryptRecipient, error) {
+	if len(password) == 0 {
+		return nil, errors.New("age: empty scrypt password")
+	}
+	return &ScryptRecipient{password: []byte(password), workFactor: DefaultScryptWorkFactor}, nil
+}
+
+// SetWorkFactor sets the log2 of the scrypt N parameter.
+func (r *ScryptRecipient) SetWorkFactor(logN int) {
+	if logN > 30 || logN < 1 {
+		panic("age: SetWorkFactor called with illegal value")
+	}
+	r.workFactor = logN
+}
+
+func (r *ScryptRecipient) Wrap(fileKey []byte) ([]*Stanza, error) {
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+
+	logN := r.workFactor
+	l := &Stanza{
+		Type: "scrypt",
+		Args: []string{b64.EncodeToString(salt), strconv.Itoa(logN)},
+	}
+
+	k, err := scrypt.Key(r.password, append([]byte(scryptLabel), salt...), 1<<logN, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("age: failed to generate scrypt hash: %v", err)
+	}
+
+	l.Body, err = aeadEncrypt(k, fileKey)
+	if err != nil {
+		return nil, err
+	}
+	return []*Stanza{l}, nil
+}
+
+// ScryptIdentity decrypts files encrypted to a passphrase.
+type ScryptIdentity struct {
+	password      []byte
+	maxWorkFactor int
+}
+
+func NewScryptIdentity(password string) (*ScryptIdentity, error) {
+	if len(password) == 0 {
+		return nil, errors.New("age: empty scrypt password")
+	}
+	return &ScryptIdentity{password: []byte(password), maxWorkFactor: 22}, nil
+}
+
+// SetMaxWorkFactor bounds the scrypt work factor accepted when decrypting,
+// to limit the cost of opening untrusted files.
+func (i *ScryptIdentity) SetMaxWorkFactor(logN int) {
+	if logN > 30 || logN < 1 {
+		panic("age: SetMaxWorkFactor called with illegal value")
+	}
+	i.maxWorkFactor = logN
+}
+
+func (i *ScryptIdentity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	for _, s := range stanzas {
+		if s.Type == "scrypt" && len(stanzas) != 1 {
+			return nil, errors.New("age: an scrypt recipient must be the only one")
+		}
+	}
+	return multiUnwrap(i.unwrap, stanzas)
+}
+
+var digitsRe = regexp.MustCompile(`^[1-9][0-9]*$`)
+
+func (i *ScryptIdentity) unwrap(block *Stanza) ([]byte, error) {
+	if block.Type != "scrypt" {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(block.Args) != 2 {
+		return nil, errors.New("age: invalid scrypt recipient block")
+	}
+	salt, err := b64.DecodeString(block.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("age: failed to parse scrypt salt: %v", err)
+	}
+	if len(salt) != 16 {
+		return nil, errors.New("age: invalid scrypt recipient block")
+	}
+	if !digitsRe.MatchString(block.Args[1]) {
+		return nil, fmt.Errorf("age: invalid scrypt work factor: %v", block.Args[1])
+	}
+	logN, err := strconv.Atoi(block.Args[1])
+	if err != nil {
+		return nil, fmt.Errorf("age: failed to parse scrypt work factor: %v", err)
+	}
+	if logN > i.maxWorkFactor {
+		return nil, fmt.Errorf("age: scrypt work factor too large: %v", logN)
+	}
+	if logN <= 0 {
+		return nil, fmt.Errorf("age: invalid scrypt work factor: %v", logN)
+	}
+
+	k, err := scrypt.Key(i.password, append([]byte(scryptLabel), salt...), 1<<logN, 8, 1, 32)
+	if err != nil {
+		return nil, fmt.Errorf("age: failed to generate scrypt hash: %v", err)
+	}
+
+	fileKey, err := aeadDecrypt(k, fileKeySize, block.Body)
+	if err != nil {
+		return nil, ErrIncorrectIdentity
+	}
+	return fileKey, nil
+}
@@ -0,0 +1,177 @@
+package age
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"errors"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// The payload is encrypted with the STREAM construction in 64 KiB chunks.
+// Each nonce is an 11-byte big-endian chunk counter followed by a flag that
+// is set on the final chunk.
+
+const (
+	chunkSize     = 64 * 1024
+	encChunkSize  = chunkSize + chacha20poly1305.Overhead
+	lastChunkFlag = 0x01
+)
+
+type streamNonce [chacha20poly1305.NonceSize]byte
+
+func (n *streamNonce) setLast(last bool) {
+	if last {
+		n[len(n)-1] = lastChunkFlag
+	} else {
+		n[len(n)-1] = 0
+	}
+}
+
+func (n *streamNonce) increment() error {
+	for i := len(n) - 2; i >= 0; i-- {
+		n[i]++
+		if n[i] != 0 {
+			return nil
+		}
+	}
+	return errors.New("age: stream chunk counter overflow")
+}
+
+type streamWriter struct {
+	aead  cipher.AEAD
+	dst   io.Writer
+	nonce streamNonce
+	buf   []byte
+	err   error
+}
+
+func newStreamWriter(key []byte, dst io.Writer) (*streamWriter, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamWriter{aead: aead, dst: dst, buf: make([]byte, 0, encChunkSize)}, nil
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+
+	total := len(p)
+	for len(p) > 0 {
+		// A full chunk is only flushed once more data arrives, since the
+		// final chunk has to carry the last flag.
+		if len(w.buf) == chunkSize {
+			if err := w.flushChunk(false); err != nil {
+				w.err = err
+				return 0, err
+			}
+		}
+
+		n := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+n]
+		p = p[n:]
+	}
+	return total, nil
+}
+
+// Close writes the final chunk. It does not close the underlying writer.
+func (w *streamWriter) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+
+	w.err = w.flushChunk(true)
+	if w.err != nil {
+		return w.err
+	}
+	w.err = errors.New("age: write on closed writer")
+	return nil
+}
+
+func (w *streamWriter) flushChunk(last bool) error {
+	w.nonce.setLast(last)
+	out := w.aead.Seal(w.buf[:0], w.nonce[:], w.buf, nil)
+	if _, err := w.dst.Write(out); err != nil {
+		return err
+	}
+	w.buf = w.buf[:0]
+	return w.nonce.increment()
+}
+
+type streamReader struct {
+	aead  cipher.AEAD
+	src   *bufio.Reader
+	nonce streamNonce
+	buf   []byte
+	out   []byte
+	done  bool
+	err   error
+}
+
+func newStreamReader(key []byte, src io.Reader) (*streamReader, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &streamReader{
+		aead: aead,
+		src:  bufio.NewReaderSize(src, encChunkSize),
+		buf:  make([]byte, encChunkSize),
+	}, nil
+}
+
+func (r *streamReader) Read(p []byte) (int, error) {
+	for len(r.out) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.readChunk(); err != nil {
+			r.err = err
+		}
+	}
+
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+func (r *streamReader) readChunk() error {
+	first := r.nonce == streamNonce{}
+
+	n, err := io.ReadFull(r.src, r.buf)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+
+	last := n < encChunkSize
+	if !last {
+		if _, err := r.src.Peek(1); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	r.nonce.setLast(last)
+	out, err := r.aead.Open(r.buf[:0], r.nonce[:], r.buf[:n], nil)
+	if err != nil {
+		return errors.New("age: failed to decrypt and authenticate payload chunk")
+	}
+	if last && len(out) == 0 && !first {
+		return errors.New("age: final STREAM chunk is empty")
+	}
+	if err := r.nonce.increment(); err != nil {
+		return err
+	}
+
+	r.out = out
+	r.done = last
+	return nil
+}
@@ -0,0 +1,221 @@
+package age
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lyonnee/key25519"
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const x25519Label = "age-encryption.org/v1/X25519"
+
+// X25519Recipient is the standard age public key, encoded as "age1...".
+type X25519Recipient struct {
+	theirPublicKey []byte
+}
+
+// NewX25519Recipient returns a recipient for a raw X25519 public key.
+func NewX25519Recipient(publicKey []byte) (*X25519Recipient, error) {
+	if len(publicKey) != curve25519.PointSize {
+		return nil, errors.New("age: invalid X25519 public key")
+	}
+	return &X25519Recipient{theirPublicKey: append([]byte(nil), publicKey...)}, nil
+}
+
+// RecipientFromPublicKey returns the recipient matching the identity of the
+// KeyPair that owns pubKey, so files can be encrypted to a known Ed25519
+// identity.
+func RecipientFromPublicKey(pubKey key25519.PublicKey) (*X25519Recipient, error) {
+	ecdhPubKey, err := pubKey.ToX25519()
+	if err != nil {
+		return nil, err
+	}
+	return NewX25519Recipient(ecdhPubKey)
+}
+
+// ParseX25519Recipient parses an "age1..." recipient string.
+func ParseX25519Recipient(s string) (*X25519Recipient, error) {
+	t, k, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed recipient %q: %v", s, err)
+	}
+	if t != "age" {
+		return nil, fmt.Errorf("age: malformed recipient %q: invalid type %q", s, t)
+	}
+	return NewX25519Recipient(k)
+}
+
+func (r *X25519Recipient) Wrap(fileKey []byte) ([]*Stanza, error) {
+	ephemeral := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(ephemeral); err != nil {
+		return nil, err
+	}
+	ourPublicKey, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	sharedSecret, err := curve25519.X25519(ephemeral, r.theirPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, 0, len(ourPublicKey)+len(r.theirPublicKey))
+	salt = append(salt, ourPublicKey...)
+	salt = append(salt, r.theirPublicKey...)
+	wrappingKey, err := hkdfSHA256(sharedSecret, salt, x25519Label)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := aeadEncrypt(wrappingKey, fileKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return []*Stanza{{
+		Type: "X25519",
+		Args: []string{b64.EncodeToString(ourPublicKey)},
+		Body: wrappedKey,
+	}}, nil
+}
+
+// String returns the "age1..." encoding of the recipient.
+func (r *X25519Recipient) String() string {
+	s, _ := bech32Encode("age", r.theirPublicKey)
+	return s
+}
+
+// X25519Identity is the standard age private key, encoded as
+// "AGE-SECRET-KEY-1...".
+type X25519Identity struct {
+	secretKey, ourPublicKey []byte
+}
+
+// NewX25519Identity returns an identity for a raw X25519 key pair, such as
+// the one returned by key25519.KeyPair.ExportEcdhKeyPairScheme with
+// x25519.SchemeLibsodium.
+func NewX25519Identity(kp *x25519.KeyPair) (*X25519Identity, error) {
+	if len(kp.PrivateKey) != curve25519.ScalarSize {
+		return nil, errors.New("age: invalid X25519 secret key")
+	}
+	pubKey, err := curve25519.X25519(kp.PrivateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &X25519Identity{
+		secretKey:    append([]byte(nil), kp.PrivateKey...),
+		ourPublicKey: pubKey,
+	}, nil
+}
+
+// IdentityFromKeyPair returns the identity of the X25519 half of kp, which
+// decrypts files encrypted to RecipientFromPublicKey(kp.PublicKey()).
+func IdentityFromKeyPair(kp *key25519.KeyPair) (*X25519Identity, error) {
+	x25519kp, err := kp.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		return nil, err
+	}
+	return NewX25519Identity(x25519kp)
+}
+
+// ParseX25519Identity parses an "AGE-SECRET-KEY-1..." identity string.
+func ParseX25519Identity(s string) (*X25519Identity, error) {
+	t, k, err := bech32Decode(s)
+	if err != nil {
+		return nil, fmt.Errorf("age: malformed secret key: %v", err)
+	}
+	if t != "age-secret-key-" {
+		return nil, fmt.Errorf("age: malformed secret key: unknown type %q", t)
+	}
+	return NewX25519Identity(&x25519.KeyPair{PrivateKey: k})
+}
+
+func (i *X25519Identity) Unwrap(stanzas []*Stanza) ([]byte, error) {
+	return multiUnwrap(i.unwrap, stanzas)
+}
+
+func (i *X25519Identity) unwrap(block *Stanza) ([]byte, error) {
+	if block.Type != "X25519" {
+		return nil, ErrIncorrectIdentity
+	}
+	if len(block.Args) != 1 {
+		return nil, errors.New("age: invalid X25519 recipient block")
+	}
+	publicKey, err := b64.DecodeString(block.Args[0])
+	if err != nil {
+		return nil, fmt.Errorf("age: failed to parse X25519 recipient: %v", err)
+	}
+	if len(publicKey) != curve25519.PointSize {
+		return nil, errors.New("age: invalid X25519 recipient block")
+	}
+
+	sharedSecret, err := curve25519.X25519(i.secretKey, publicKey)
+	if err != nil {
+		return nil, fmt.Errorf("age: invalid X25519 recipient: %v", err)
+	}
+
+	salt := make([]byte, 0, len(publicKey)+len(i.ourPublicKey))
+	salt = append(salt, publicKey...)
+	salt = append(salt, i.ourPublicKey...)
+	wrappingKey, err := hkdfSHA256(sharedSecret, salt, x25519Label)
+	if err != nil {
+		return nil, err
+	}
+
+	fileKey, err := aeadDecrypt(wrappingKey, fileKeySize, block.Body)
+	if err != nil {
+		return nil, ErrIncorrectIdentity
+	}
+	return fileKey, nil
+}
+
+// Recipient returns the public recipient of the identity.
+func (i *X25519Identity) Recipient() *X25519Recipient {
+	return &X25519Recipient{theirPublicKey: i.ourPublicKey}
+}
+
+// String returns the "AGE-SECRET-KEY-1..." encoding of the identity.
+func (i *X25519Identity) String() string {
+	s, _ := bech32Encode("AGE-SECRET-KEY-", i.secretKey)
+	return strings.ToUpper(s)
+}
+
+func hkdfSHA256(secret, salt []byte, info string) ([]byte, error) {
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// aeadEncrypt and aeadDecrypt wrap file keys with ChaCha20-Poly1305 and an
+// all-zero nonce; every wrapping key is used exactly once.
+func aeadEncrypt(key, plaintext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Seal(nil, nonce, plaintext, nil), nil
+}
+
+func aeadDecrypt(key []byte, size int, ciphertext []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) != size+aead.Overhead() {
+		return nil, errors.New("age: encrypted value has unexpected length")
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
@@ -0,0 +1,168 @@
+package key25519
+
+import (
+	"crypto/sha512"
+	"fmt"
+	"testing"
+
+	"filippo.io/edwards25519"
+)
+
+// order8Point is the encoding of a point of order 8.
+const order8Point = "26e8958fc2b227b045c3f489f2ef98f0d5dfac05d3c63339b13802886d53fc05"
+
+// signWithTorsion signs msg like Ed25519 but adds the small-order point t to
+// the nonce commitment R. The result satisfies the cofactored equation but
+// not the cofactorless one.
+func signWithTorsion(t *testing.T, kp *KeyPair, msg []byte, torsion *edwards25519.Point) []byte {
+	t.Helper()
+	h := sha512.Sum512(kp.PrivateKey().ToEd25519PrivKey().Seed())
+	a, err := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rh := sha512.Sum512(append(h[32:], msg...))
+	r, err := edwards25519.NewScalar().SetUniformBytes(rh[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	R := new(edwards25519.Point).ScalarBaseMult(r)
+	R.Add(R, torsion)
+
+	kh := sha512.New()
+	kh.Write(R.Bytes())
+	kh.Write(kp.PublicKey().Bytes())
+	kh.Write(msg)
+	k, err := edwards25519.NewScalar().SetUniformBytes(kh.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := edwards25519.NewScalar().MultiplyAdd(k, a, r)
+	return append(R.Bytes(), s.Bytes()...)
+}
+
+func torsionPoint(t *testing.T) *edwards25519.Point {
+	t.Helper()
+	p, err := new(edwards25519.Point).SetBytes(decodeHex(t, order8Point))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+type batchInput struct {
+	pubKeys []PublicKey
+	msgs    [][]byte
+	sigs    [][]byte
+}
+
+func newBatchInput(n int) *batchInput {
+	in := &batchInput{
+		pubKeys: make([]PublicKey, n),
+		msgs:    make([][]byte, n),
+		sigs:    make([][]byte, n),
+	}
+	for i := 0; i < n; i++ {
+		kp := NewKeyPair()
+		in.pubKeys[i] = kp.PublicKey()
+		in.msgs[i] = []byte(fmt.Sprintf("msg %d", i))
+		in.sigs[i] = kp.PrivateKey().SignMsg(in.msgs[i])
+	}
+	return in
+}
+
+func (in *batchInput) verifier() *BatchVerifier {
+	bv := NewBatchVerifier()
+	for i := range in.pubKeys {
+		bv.Add(in.pubKeys[i], in.msgs[i], in.sigs[i])
+	}
+	return bv
+}
+
+func TestBatchVerify(t *testing.T) {
+	in := newBatchInput(32)
+	ok, valid := in.verifier().Verify(nil)
+	if !ok {
+		t.Fatal("valid batch rejected")
+	}
+	for i, v := range valid {
+		if !v {
+			t.Fatalf("entry %d reported invalid", i)
+		}
+	}
+
+	in.msgs[7] = []byte("tampered")
+	ok, valid = in.verifier().Verify(nil)
+	if ok {
+		t.Fatal("batch with a tampered entry accepted")
+	}
+	for i, v := range valid {
+		if v != (i != 7) {
+			t.Fatalf("entry %d: valid = %v", i, v)
+		}
+	}
+
+	if ok, valid := NewBatchVerifier().Verify(nil); !ok || len(valid) != 0 {
+		t.Fatal("empty batch rejected")
+	}
+}
+
+func TestBatchVerifyTorsionConsistent(t *testing.T) {
+	kp := NewKeyPair()
+	msg := []byte("mixed-order R")
+	sig := signWithTorsion(t, kp, msg, torsionPoint(t))
+
+	if kp.PublicKey().VerifyMsg(msg, sig) {
+		t.Fatal("cofactorless VerifyMsg accepted a torsioned R")
+	}
+	if !kp.PublicKey().VerifyMsgWithMode(msg, sig, VerifyZIP215) {
+		t.Fatal("VerifyZIP215 rejected a torsioned R")
+	}
+
+	// The entry must get the same verdict whether the batch equation
+	// passes or the per-entry fallback runs.
+	in := newBatchInput(4)
+	in.pubKeys = append(in.pubKeys, kp.PublicKey())
+	in.msgs = append(in.msgs, msg)
+	in.sigs = append(in.sigs, sig)
+
+	ok, valid := in.verifier().Verify(nil)
+	if !ok || !valid[4] {
+		t.Fatalf("batch verdict = %v, entry = %v; want both true", ok, valid[4])
+	}
+
+	in.msgs[0] = []byte("tampered")
+	ok, valid = in.verifier().Verify(nil)
+	if ok || valid[0] || !valid[4] {
+		t.Fatalf("batch = %v, tampered entry = %v, torsion entry = %v", ok, valid[0], valid[4])
+	}
+}
+
+func BenchmarkVerifyMsg(b *testing.B) {
+	for _, n := range []int{8, 64, 256} {
+		in := newBatchInput(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				for j := range in.pubKeys {
+					if !in.pubKeys[j].VerifyMsg(in.msgs[j], in.sigs[j]) {
+						b.Fatal("invalid signature")
+					}
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkBatchVerify(b *testing.B) {
+	for _, n := range []int{8, 64, 256} {
+		in := newBatchInput(n)
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if ok, _ := in.verifier().Verify(nil); !ok {
+					b.Fatal("invalid batch")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Package box implements NaCl/libsodium crypto_box (X25519, XSalsa20 and
+// Poly1305) between key25519 key pairs. Key pairs are converted to X25519
+// the same way libsodium's crypto_sign_ed25519_sk_to_curve25519 does, and
+// boxes use the libsodium "easy" layout (tag followed by ciphertext).
+package box
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lyonnee/key25519"
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	// NonceSize is the size of a crypto_box nonce.
+	NonceSize = 24
+	// SharedKeySize is the size of a precomputed shared key.
+	SharedKeySize = 32
+	// Overhead is the number of bytes a box adds to its message.
+	Overhead = box.Overhead
+)
+
+var ErrOpen = errors.New("box: message authentication failed")
+
+// GenerateNonce reads a random nonce from rand. Nonces must never be reused
+// with the same pair of keys.
+func GenerateNonce(rand io.Reader) (*[NonceSize]byte, error) {
+	nonce := new([NonceSize]byte)
+	if _, err := io.ReadFull(rand, nonce[:]); err != nil {
+		return nil, fmt.Errorf("reading nonce failed: %w", err)
+	}
+	return nonce, nil
+}
+
+// Precompute computes the crypto_box_beforenm shared key between kp and the
+// peer's X25519 public key. Low-order peer keys are rejected.
+func Precompute(peerPubKey []byte, kp *key25519.KeyPair) (*[SharedKeySize]byte, error) {
+	x25519kp, err := kp.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		return nil, err
+	}
+
+	// box.Precompute accepts any point; X25519 rejects the low-order ones.
+	if _, err := curve25519.X25519(x25519kp.PrivateKey, peerPubKey); err != nil {
+		return nil, err
+	}
+
+	var peer, privKey [32]byte
+	copy(peer[:], peerPubKey)
+	copy(privKey[:], x25519kp.PrivateKey)
+	sharedKey := new([SharedKeySize]byte)
+	box.Precompute(sharedKey, &peer, &privKey)
+	return sharedKey, nil
+}
+
+// Seal appends an encrypted and authenticated copy of message to out,
+// addressed to the peer's X25519 public key.
+func Seal(out, message []byte, nonce *[NonceSize]byte, peerPubKey []byte, kp *key25519.KeyPair) ([]byte, error) {
+	sharedKey, err := Precompute(peerPubKey, kp)
+	if err != nil {
+		return nil, err
+	}
+	return SealAfterPrecomputation(out, message, nonce, sharedKey), nil
+}
+
+// Open authenticates and decrypts a box sent by the peer's X25519 public
+// key, appending the message to out.
+func Open(out, sealed []byte, nonce *[NonceSize]byte, peerPubKey []byte, kp *key25519.KeyPair) ([]byte, error) {
+	sharedKey, err := Precompute(peerPubKey, kp)
+	if err != nil {
+		return nil, err
+	}
+	return OpenAfterPrecomputation(out, sealed, nonce, sharedKey)
+}
+
+// SealAfterPrecomputation is Seal using a key from Precompute.
+func SealAfterPrecomputation(out, message []byte, nonce *[NonceSize]byte, sharedKey *[SharedKeySize]byte) []byte {
+	return box.SealAfterPrecomputation(out, message, nonce, sharedKey)
+}
+
+// OpenAfterPrecomputation is Open using a key from Precompute.
+func OpenAfterPrecomputation(out, sealed []byte, nonce *[NonceSize]byte, sharedKey *[SharedKeySize]byte) ([]byte, error) {
+	message, ok := box.OpenAfterPrecomputation(out, sealed, nonce, sharedKey)
+	if !ok {
+		return nil, ErrOpen
+	}
+	return message, nil
+}
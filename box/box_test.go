@@ -0,0 +1,111 @@
+package box
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+
+	"github.com/lyonnee/key25519"
+)
+
+// Ed25519 seeds of RFC 8032 tests 1 and 2, and the crypto_box_easy of
+// boxMessage from alice to bob under boxNonce, computed with libsodium after
+// converting both keys with crypto_sign_ed25519_{pk,sk}_to_curve25519.
+const (
+	aliceSeed = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+	bobSeed   = "4ccd089b28ff96da9db6c346ec114e0f5b8a319f35aba624da8cf6ed4fb8a6fb"
+
+	aliceX25519PubKey = "d85e07ec22b0ad881537c2f44d662d1a143cf830c57aca4305d85c7a90f6b62e"
+	bobX25519PubKey   = "25c704c594b88afc00a76b69d1ed2b984d7e22550f3ed0802d04fbcd07d38d47"
+
+	boxMessage   = "key25519 crypto_box interop"
+	libsodiumBox = "24f1318194ac28024ef85687785753137a91f71f4a5fe31f7d5c3555abe5aba42408505009e1e3e2f812c6"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func keyPair(t *testing.T, seed string) *key25519.KeyPair {
+	t.Helper()
+	kp, err := key25519.NewKeyPairFromSeed(mustHex(t, seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kp
+}
+
+func boxNonce() *[NonceSize]byte {
+	nonce := new([NonceSize]byte)
+	for i := range nonce {
+		nonce[i] = byte(i)
+	}
+	return nonce
+}
+
+func TestLibsodiumBox(t *testing.T) {
+	alice, bob := keyPair(t, aliceSeed), keyPair(t, bobSeed)
+
+	sealed, err := Seal(nil, []byte(boxMessage), boxNonce(), mustHex(t, bobX25519PubKey), alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(sealed); got != libsodiumBox {
+		t.Fatalf("Seal = %s, want %s", got, libsodiumBox)
+	}
+
+	message, err := Open(nil, mustHex(t, libsodiumBox), boxNonce(), mustHex(t, aliceX25519PubKey), bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != boxMessage {
+		t.Fatalf("Open = %q, want %q", message, boxMessage)
+	}
+}
+
+func TestPrecompute(t *testing.T) {
+	alice, bob := keyPair(t, aliceSeed), keyPair(t, bobSeed)
+
+	k1, err := Precompute(mustHex(t, bobX25519PubKey), alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k2, err := Precompute(mustHex(t, aliceX25519PubKey), bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *k1 != *k2 {
+		t.Fatal("shared keys differ")
+	}
+
+	nonce, err := GenerateNonce(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed := SealAfterPrecomputation(nil, []byte(boxMessage), nonce, k1)
+	if len(sealed) != len(boxMessage)+Overhead {
+		t.Fatalf("box length = %d, want %d", len(sealed), len(boxMessage)+Overhead)
+	}
+	message, err := OpenAfterPrecomputation(nil, sealed, nonce, k2)
+	if err != nil || !bytes.Equal(message, []byte(boxMessage)) {
+		t.Fatalf("OpenAfterPrecomputation = %q, %v", message, err)
+	}
+
+	sealed[0] ^= 1
+	if _, err := OpenAfterPrecomputation(nil, sealed, nonce, k2); err != ErrOpen {
+		t.Fatalf("tampered box: err = %v, want ErrOpen", err)
+	}
+}
+
+func TestPrecomputeRejectsLowOrder(t *testing.T) {
+	alice := keyPair(t, aliceSeed)
+	if _, err := Precompute(make([]byte, 32), alice); err == nil {
+		t.Fatal("Precompute accepted the all-zero public key")
+	}
+}
@@ -0,0 +1,45 @@
+package box
+
+import (
+	"io"
+
+	"github.com/lyonnee/key25519"
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// AnonymousOverhead is the number of bytes a sealed box adds to its message:
+// the ephemeral public key followed by the authentication tag.
+const AnonymousOverhead = box.AnonymousOverhead
+
+// SealAnonymous appends a libsodium crypto_box_seal of message to out. The
+// box is encrypted from a fresh ephemeral key to the X25519 form of the
+// recipient's Ed25519 public key, so it carries no sender identity.
+func SealAnonymous(out, message []byte, recipient key25519.PublicKey, rand io.Reader) ([]byte, error) {
+	recipientEcdhPubKey, err := recipient.ToX25519()
+	if err != nil {
+		return nil, err
+	}
+
+	var peer [32]byte
+	copy(peer[:], recipientEcdhPubKey)
+	return box.SealAnonymous(out, message, &peer, rand)
+}
+
+// OpenAnonymous opens a sealed box addressed to kp, appending the message to
+// out.
+func OpenAnonymous(out, sealed []byte, kp *key25519.KeyPair) ([]byte, error) {
+	x25519kp, err := kp.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		return nil, err
+	}
+
+	var pubKey, privKey [32]byte
+	copy(pubKey[:], x25519kp.PublicKey)
+	copy(privKey[:], x25519kp.PrivateKey)
+	message, ok := box.OpenAnonymous(out, sealed, &pubKey, &privKey)
+	if !ok {
+		return nil, ErrOpen
+	}
+	return message, nil
+}
@@ -0,0 +1,51 @@
+package box
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+// libsodiumSeal is a crypto_box_seal of boxMessage to bob's converted X25519
+// public key, produced by libsodium.
+const libsodiumSeal = "7135fa3a752171d414efbaef8bbd99ef903ace4e055c500e9a40f5a7b02a985655474f46345102e7a68645062bf4f009c71db8e16f80ad9354019c3b28d9478e85ebaa56416d0972983012"
+
+func TestLibsodiumSealedBox(t *testing.T) {
+	bob := keyPair(t, bobSeed)
+
+	message, err := OpenAnonymous(nil, mustHex(t, libsodiumSeal), bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != boxMessage {
+		t.Fatalf("OpenAnonymous = %q, want %q", message, boxMessage)
+	}
+
+	if _, err := OpenAnonymous(nil, mustHex(t, libsodiumSeal), keyPair(t, aliceSeed)); err != ErrOpen {
+		t.Fatalf("wrong recipient: err = %v, want ErrOpen", err)
+	}
+}
+
+func TestSealAnonymous(t *testing.T) {
+	bob := keyPair(t, bobSeed)
+
+	sealed, err := SealAnonymous(nil, []byte(boxMessage), bob.PublicKey(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sealed) != len(boxMessage)+AnonymousOverhead {
+		t.Fatalf("sealed box length = %d, want %d", len(sealed), len(boxMessage)+AnonymousOverhead)
+	}
+
+	message, err := OpenAnonymous(nil, sealed, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != boxMessage {
+		t.Fatalf("OpenAnonymous = %q, want %q", message, boxMessage)
+	}
+
+	sealed[len(sealed)-1] ^= 1
+	if _, err := OpenAnonymous(nil, sealed, bob); err != ErrOpen {
+		t.Fatalf("tampered box: err = %v, want ErrOpen", err)
+	}
+}
@@ -4,16 +4,34 @@ import "github.com/lyonnee/key25519/x25519"
 
 // ECDH functions for KeyPair
 
+// ExportEcdhKeyPair converts the key pair to X25519 with x25519.SchemeLegacy,
+// as earlier versions of this package did. Use ExportEcdhKeyPairScheme with
+// x25519.SchemeLibsodium to interoperate with other libraries.
 func (kp *KeyPair) ExportEcdhKeyPair() (*x25519.KeyPair, error) {
-	return x25519.GenerateKeyPair(kp.privKey.Bytes())
+	return kp.privKey.ExportEcdhKeyPair()
+}
+
+// ExportEcdhKeyPairScheme converts the key pair to X25519 with the given
+// scheme.
+func (kp *KeyPair) ExportEcdhKeyPairScheme(scheme x25519.Scheme) (*x25519.KeyPair, error) {
+	return kp.privKey.ExportEcdhKeyPairScheme(scheme)
 }
 
 func (kp *KeyPair) ECDH(peerEcdhPubKey []byte) ([]byte, error) {
-	x25519kp, err := kp.ExportEcdhKeyPair()
-	if err != nil {
-		return nil, err
-	}
-	return x25519kp.EcdhShare(peerEcdhPubKey)
+	return kp.privKey.ECDH(peerEcdhPubKey)
+}
+
+// ECDHScheme is ECDH with the key pair converted using the given scheme.
+func (kp *KeyPair) ECDHScheme(peerEcdhPubKey []byte, scheme x25519.Scheme) ([]byte, error) {
+	return kp.privKey.ECDHScheme(peerEcdhPubKey, scheme)
+}
+
+// ECDHWithKDF is ECDH with a caller-chosen KDF instead of the legacy SHA-256.
+// The key pair is converted with x25519.SchemeLibsodium, so the secret
+// matches libsodium, age and other X25519 implementations. For the legacy
+// scheme, use ExportEcdhKeyPair and x25519.KeyPair.DeriveShare.
+func (kp *KeyPair) ECDHWithKDF(peerEcdhPubKey []byte, kdf x25519.KDF) ([]byte, error) {
+	return kp.privKey.ECDHWithKDF(peerEcdhPubKey, kdf)
 }
 
 // PrivateKey functions for KeyPair
@@ -22,10 +40,43 @@ func (privKey PrivateKey) ExportEcdhKeyPair() (*x25519.KeyPair, error) {
 	return x25519.GenerateKeyPair(privKey.ToEd25519PrivKey())
 }
 
+func (privKey PrivateKey) ExportEcdhKeyPairScheme(scheme x25519.Scheme) (*x25519.KeyPair, error) {
+	return x25519.GenerateKeyPairWithScheme(privKey.ToEd25519PrivKey(), scheme)
+}
+
 func (privKey PrivateKey) ECDH(peerEcdhPubKey []byte) ([]byte, error) {
-	x25519kp, err := x25519.GenerateKeyPair(privKey.ToEd25519PrivKey())
+	return privKey.ECDHScheme(peerEcdhPubKey, x25519.SchemeLegacy)
+}
+
+func (privKey PrivateKey) ECDHScheme(peerEcdhPubKey []byte, scheme x25519.Scheme) ([]byte, error) {
+	x25519kp, err := privKey.ExportEcdhKeyPairScheme(scheme)
 	if err != nil {
 		return nil, err
 	}
 	return x25519kp.EcdhShare(peerEcdhPubKey)
 }
+
+func (privKey PrivateKey) ECDHWithKDF(peerEcdhPubKey []byte, kdf x25519.KDF) ([]byte, error) {
+	x25519kp, err := privKey.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		return nil, err
+	}
+	return x25519kp.DeriveShare(peerEcdhPubKey, kdf)
+}
+
+// ECDH functions against Ed25519 identities
+
+// ECDHWithEd25519Peer agrees on a secret with the owner of an Ed25519 public
+// key. Both sides use the X25519 keys birationally equivalent to their
+// Ed25519 keys, so no ECDH key has to be exchanged out-of-band.
+func (kp *KeyPair) ECDHWithEd25519Peer(peerPubKey PublicKey) ([]byte, error) {
+	return kp.privKey.ECDHWithEd25519Peer(peerPubKey)
+}
+
+func (privKey PrivateKey) ECDHWithEd25519Peer(peerPubKey PublicKey) ([]byte, error) {
+	peerEcdhPubKey, err := peerPubKey.ToX25519()
+	if err != nil {
+		return nil, err
+	}
+	return privKey.ECDHScheme(peerEcdhPubKey, x25519.SchemeLibsodium)
+}
@@ -0,0 +1,197 @@
+package key25519
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Vectors generated with libsodium's crypto_sign_seed_keypair,
+// crypto_sign_ed25519_pk_to_curve25519 and
+// crypto_sign_ed25519_sk_to_curve25519. The first one is from libsodium's
+// test/default/ed25519_convert.c.
+var libsodiumConvertVectors = []struct {
+	seed, edPub, xPub, xPriv string
+}{
+	{
+		"421151a459faeade3d247115f94aedae42318124095afabe4d1451a559faedee",
+		"b5076a8474a832daee4dd5b4040983b6623b5f344aca57d4d6ee4baf3f259e6e",
+		"f1814f0e8ff1043d8a44d25babff3cedcae6c22c3edaa48f857ae70de2baae50",
+		"8052030376d47112be7f73ed7a019293dd12ad910b654455798b4667d73de166",
+	},
+	{
+		"9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60",
+		"d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a",
+		"d85e07ec22b0ad881537c2f44d662d1a143cf830c57aca4305d85c7a90f6b62e",
+		"307c83864f2833cb427a2ef1c00a013cfdff2768d980c0a3a520f006904de94f",
+	},
+	{
+		"0000000000000000000000000000000000000000000000000000000000000000",
+		"3b6a27bcceb6a42d62a3a8d02a6f0d73653215771de243a63ac048a18b59da29",
+		"5bf55c73b82ebe22be80f3430667af570fae2556a6415e6b30d4065300aa947d",
+		"5046adc1dba838867b2bbbfdd0c3423e58b57970b5267a90f57960924a87f156",
+	},
+}
+
+func decodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestLibsodiumConversion(t *testing.T) {
+	for _, v := range libsodiumConvertVectors {
+		kp, err := NewKeyPairFromSeed(decodeHex(t, v.seed))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(kp.PublicKey().Bytes()); got != v.edPub {
+			t.Fatalf("ed25519 public key = %s, want %s", got, v.edPub)
+		}
+
+		xPub, err := kp.PublicKey().ToX25519()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(xPub); got != v.xPub {
+			t.Errorf("pk_to_curve25519 = %s, want %s", got, v.xPub)
+		}
+
+		xkp, err := kp.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := hex.EncodeToString(xkp.PrivateKey); got != v.xPriv {
+			t.Errorf("sk_to_curve25519 = %s, want %s", got, v.xPriv)
+		}
+		if got := hex.EncodeToString(xkp.PublicKey); got != v.xPub {
+			t.Errorf("converted X25519 public key = %s, want %s", got, v.xPub)
+		}
+	}
+}
+
+func TestExportEcdhKeyPairLegacyDefault(t *testing.T) {
+	kp, err := NewKeyPairFromSeed(decodeHex(t, libsodiumConvertVectors[0].seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := kp.ExportEcdhKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := kp.ExportEcdhKeyPairScheme(x25519.SchemeLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(def.PrivateKey, legacy.PrivateKey) || !bytes.Equal(def.PrivateKey, decodeHex(t, libsodiumConvertVectors[0].seed)) {
+		t.Error("ExportEcdhKeyPair does not use the legacy scheme")
+	}
+}
+
+func TestECDHWithEd25519Peer(t *testing.T) {
+	alice, bob := NewKeyPair(), NewKeyPair()
+
+	s1, err := alice.ECDHWithEd25519Peer(bob.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := bob.ECDHWithEd25519Peer(alice.PublicKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s1, s2) {
+		t.Error("shared secrets differ")
+	}
+
+	bobX, err := bob.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s3, err := alice.ECDHScheme(bobX.PublicKey, x25519.SchemeLibsodium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s1, s3) {
+		t.Error("ECDHWithEd25519Peer differs from ECDHScheme with the libsodium scheme")
+	}
+}
+
+func TestECDHWithKDF(t *testing.T) {
+	alice, bob := NewKeyPair(), NewKeyPair()
+	aliceX, err := alice.PublicKey().ToX25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobX, err := bob.PublicKey().ToX25519()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kdf := x25519.HKDF{Info: []byte("key25519 test"), Length: 48}
+	s1, err := alice.ECDHWithKDF(bobX, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := bob.PrivateKey().ECDHWithKDF(aliceX, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(s1, s2) || len(s1) != 48 {
+		t.Fatal("HKDF secrets differ between the two parties")
+	}
+
+	kdf.BindPublicKeys = true
+	b1, err := alice.ECDHWithKDF(bobX, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b2, err := bob.ECDHWithKDF(aliceX, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b1, b2) {
+		t.Fatal("bound HKDF secrets differ between the two parties")
+	}
+	if bytes.Equal(b1, s1) {
+		t.Fatal("BindPublicKeys did not change the secret")
+	}
+
+	// ECDHScheme returns SHA-256 of the raw X25519 output.
+	raw, err := alice.ECDHWithKDF(bobX, x25519.KDFRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	aliceKP, err := alice.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := curve25519.X25519(aliceKP.PrivateKey, bobX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(raw, want) {
+		t.Fatal("KDFRaw is not the raw X25519 output of the libsodium-converted key")
+	}
+	hashed, err := alice.ECDHScheme(bobX, x25519.SchemeLibsodium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum := sha256.Sum256(raw); !bytes.Equal(hashed, sum[:]) {
+		t.Fatal("KDFRaw output does not match ECDHScheme before hashing")
+	}
+	legacy, err := alice.ECDHWithKDF(bobX, x25519.KDFLegacySHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(legacy, hashed) {
+		t.Fatal("KDFLegacySHA256 does not match ECDHScheme")
+	}
+}
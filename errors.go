@@ -0,0 +1,19 @@
+package key25519
+
+import "errors"
+
+var (
+	ErrInvalidLength = errors.New("key25519: invalid key length")
+	ErrKeyMismatch   = errors.New("key25519: public half of private key does not match its seed")
+	ErrInvalidPoint  = errors.New("key25519: public key is not a valid curve point")
+	ErrNonCanonical  = errors.New("key25519: public key encoding is not canonical")
+	ErrSmallOrder    = errors.New("key25519: public key is a small-order point")
+	ErrRedacted      = errors.New("key25519: private key is redacted")
+	ErrWrongKeyType  = errors.New("key25519: not an Ed25519 key")
+	ErrNoPEMBlock    = errors.New("key25519: no public key PEM block found")
+
+	ErrPassphraseRequired  = errors.New("key25519: OpenSSH private key is encrypted")
+	ErrIncorrectPassphrase = errors.New("key25519: incorrect OpenSSH passphrase")
+
+	errEmptyContext = errors.New("key25519: Ed25519ctx requires a non-empty context")
+)
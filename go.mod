@@ -3,6 +3,10 @@ module github.com/lyonnee/key25519
 go 1.20
 
 require (
+	filippo.io/edwards25519 v1.1.0
 	github.com/tyler-smith/go-bip39 v1.1.0
 	golang.org/x/crypto v0.23.0
+	golang.org/x/text v0.15.0
 )
+
+require golang.org/x/sys v0.20.0 // indirect
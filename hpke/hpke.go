@@ -0,0 +1,352 @@
+// Package hpke implements Hybrid Public Key Encryption (RFC 9180) with
+// DHKEM(X25519, HKDF-SHA256) on top of x25519 key pairs. Keys converted
+// with key25519.KeyPair.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium) and
+// PublicKey.ToX25519 can be used directly.
+package hpke
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+)
+
+type KEM uint16
+
+const DHKEMX25519HKDFSHA256 KEM = 0x0020
+
+type KDF uint16
+
+const (
+	KDFHKDFSHA256 KDF = 0x0001
+	KDFHKDFSHA512 KDF = 0x0003
+)
+
+type AEAD uint16
+
+const (
+	AEADAES128GCM        AEAD = 0x0001
+	AEADAES256GCM        AEAD = 0x0002
+	AEADChaCha20Poly1305 AEAD = 0x0003
+	// AEADExportOnly disables Seal and Open; only Export is available.
+	AEADExportOnly AEAD = 0xFFFF
+)
+
+type mode uint8
+
+const (
+	modeBase    mode = 0x00
+	modePSK     mode = 0x01
+	modeAuth    mode = 0x02
+	modeAuthPSK mode = 0x03
+)
+
+var (
+	ErrUnsupportedSuite = errors.New("hpke: unsupported cipher suite")
+	ErrInvalidPSK       = errors.New("hpke: psk and psk_id must both be set, or both be empty")
+	ErrExportOnly       = errors.New("hpke: export-only context cannot seal or open")
+	ErrMessageLimit     = errors.New("hpke: message limit reached")
+	ErrOpen             = errors.New("hpke: message authentication failed")
+	ErrMissingSenderKey = errors.New("hpke: auth modes require the sender key")
+)
+
+// Suite is an HPKE cipher suite. The KEM is always DHKEM(X25519, HKDF-SHA256).
+type Suite struct {
+	KDF  KDF
+	AEAD AEAD
+}
+
+func NewSuite(kdf KDF, aead AEAD) Suite {
+	return Suite{KDF: kdf, AEAD: aead}
+}
+
+func (s Suite) id() []byte {
+	id := []byte("HPKE")
+	id = binary.BigEndian.AppendUint16(id, uint16(DHKEMX25519HKDFSHA256))
+	id = binary.BigEndian.AppendUint16(id, uint16(s.KDF))
+	id = binary.BigEndian.AppendUint16(id, uint16(s.AEAD))
+	return id
+}
+
+func (s Suite) check() error {
+	if s.KDF.newHash() == nil {
+		return ErrUnsupportedSuite
+	}
+	switch s.AEAD {
+	case AEADAES128GCM, AEADAES256GCM, AEADChaCha20Poly1305, AEADExportOnly:
+		return nil
+	default:
+		return ErrUnsupportedSuite
+	}
+}
+
+// SetupBaseS starts a base mode context to the recipient's public key pkR.
+func (s Suite) SetupBaseS(rand io.Reader, pkR, info []byte) ([]byte, *Sender, error) {
+	return s.setupS(rand, modeBase, pkR, info, nil, nil, nil)
+}
+
+// SetupPSKS starts a context authenticated with a pre-shared key.
+func (s Suite) SetupPSKS(rand io.Reader, pkR, info, psk, pskID []byte) ([]byte, *Sender, error) {
+	return s.setupS(rand, modePSK, pkR, info, psk, pskID, nil)
+}
+
+// SetupAuthS starts a context authenticated with the sender's key pair skS.
+func (s Suite) SetupAuthS(rand io.Reader, pkR, info []byte, skS *x25519.KeyPair) ([]byte, *Sender, error) {
+	return s.setupS(rand, modeAuth, pkR, info, nil, nil, skS)
+}
+
+// SetupAuthPSKS starts a context authenticated with both a pre-shared key
+// and the sender's key pair skS.
+func (s Suite) SetupAuthPSKS(rand io.Reader, pkR, info, psk, pskID []byte, skS *x25519.KeyPair) ([]byte, *Sender, error) {
+	return s.setupS(rand, modeAuthPSK, pkR, info, psk, pskID, skS)
+}
+
+// SetupBaseR opens a base mode context from the encapsulated key enc.
+func (s Suite) SetupBaseR(enc []byte, skR *x25519.KeyPair, info []byte) (*Receiver, error) {
+	return s.setupR(modeBase, enc, skR, info, nil, nil, nil)
+}
+
+// SetupPSKR opens a context authenticated with a pre-shared key.
+func (s Suite) SetupPSKR(enc []byte, skR *x25519.KeyPair, info, psk, pskID []byte) (*Receiver, error) {
+	return s.setupR(modePSK, enc, skR, info, psk, pskID, nil)
+}
+
+// SetupAuthR opens an auth mode context, checking that it was created by
+// the holder of the sender public key pkS.
+func (s Suite) SetupAuthR(enc []byte, skR *x25519.KeyPair, info, pkS []byte) (*Receiver, error) {
+	return s.setupR(modeAuth, enc, skR, info, nil, nil, pkS)
+}
+
+// SetupAuthPSKR opens a context authenticated with both a pre-shared key and
+// the sender public key pkS.
+func (s Suite) SetupAuthPSKR(enc []byte, skR *x25519.KeyPair, info, psk, pskID, pkS []byte) (*Receiver, error) {
+	return s.setupR(modeAuthPSK, enc, skR, info, psk, pskID, pkS)
+}
+
+func (s Suite) setupS(rand io.Reader, m mode, pkR, info, psk, pskID []byte, skS *x25519.KeyPair) ([]byte, *Sender, error) {
+	if err := s.check(); err != nil {
+		return nil, nil, err
+	}
+	if m.isAuth() && skS == nil {
+		return nil, nil, ErrMissingSenderKey
+	}
+
+	sharedSecret, enc, err := encap(rand, pkR, skS)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, err := s.keySchedule(m, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, &Sender{ctx}, nil
+}
+
+func (s Suite) setupR(m mode, enc []byte, skR *x25519.KeyPair, info, psk, pskID, pkS []byte) (*Receiver, error) {
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	if m.isAuth() && len(pkS) == 0 {
+		return nil, ErrMissingSenderKey
+	}
+
+	sharedSecret, err := decap(enc, skR, pkS)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, err := s.keySchedule(m, sharedSecret, info, psk, pskID)
+	if err != nil {
+		return nil, err
+	}
+	return &Receiver{ctx}, nil
+}
+
+func (s Suite) keySchedule(m mode, sharedSecret, info, psk, pskID []byte) (*context, error) {
+	if (len(psk) == 0) != (len(pskID) == 0) {
+		return nil, ErrInvalidPSK
+	}
+	if (len(psk) != 0) != (m == modePSK || m == modeAuthPSK) {
+		return nil, ErrInvalidPSK
+	}
+
+	suiteID := s.id()
+	h := s.KDF
+	pskIDHash := h.labeledExtract(suiteID, nil, "psk_id_hash", pskID)
+	infoHash := h.labeledExtract(suiteID, nil, "info_hash", info)
+	keyScheduleContext := append([]byte{byte(m)}, pskIDHash...)
+	keyScheduleContext = append(keyScheduleContext, infoHash...)
+
+	secret := h.labeledExtract(suiteID, sharedSecret, "secret", psk)
+
+	exporterSecret, err := h.labeledExpand(suiteID, secret, "exp", keyScheduleContext, h.newHash()().Size())
+	if err != nil {
+		return nil, err
+	}
+	ctx := &context{
+		suiteID:        suiteID,
+		kdf:            h,
+		exporterSecret: exporterSecret,
+	}
+
+	if s.AEAD == AEADExportOnly {
+		return ctx, nil
+	}
+
+	key, err := h.labeledExpand(suiteID, secret, "key", keyScheduleContext, s.AEAD.keySize())
+	if err != nil {
+		return nil, err
+	}
+	aead, err := s.AEAD.new(key)
+	if err != nil {
+		return nil, err
+	}
+	ctx.aead = aead
+	if ctx.baseNonce, err = h.labeledExpand(suiteID, secret, "base_nonce", keyScheduleContext, aead.NonceSize()); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+func (m mode) isAuth() bool {
+	return m == modeAuth || m == modeAuthPSK
+}
+
+type context struct {
+	suiteID        []byte
+	kdf            KDF
+	aead           cipher.AEAD
+	baseNonce      []byte
+	seq            uint64
+	exporterSecret []byte
+}
+
+func (c *context) nextNonce() ([]byte, error) {
+	if c.seq == ^uint64(0) {
+		return nil, ErrMessageLimit
+	}
+
+	nonce := make([]byte, len(c.baseNonce))
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], c.seq)
+	for i := range nonce {
+		nonce[i] ^= c.baseNonce[i]
+	}
+	return nonce, nil
+}
+
+// Export derives a secret of length bytes bound to exporterContext, per the
+// secret export interface of RFC 9180, section 5.3.
+func (c *context) Export(exporterContext []byte, length int) ([]byte, error) {
+	if length < 0 || length > 255*c.kdf.newHash()().Size() {
+		return nil, fmt.Errorf("hpke: invalid export length: %d", length)
+	}
+	return c.kdf.labeledExpand(c.suiteID, c.exporterSecret, "sec", exporterContext, length)
+}
+
+// Sender encrypts messages to the recipient of a context.
+type Sender struct {
+	*context
+}
+
+// Seal encrypts and authenticates the next message of the context.
+func (s *Sender) Seal(aad, plaintext []byte) ([]byte, error) {
+	if s.aead == nil {
+		return nil, ErrExportOnly
+	}
+
+	nonce, err := s.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	s.seq++
+	return s.aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+// Receiver decrypts messages sent within a context, in order.
+type Receiver struct {
+	*context
+}
+
+// Open decrypts and authenticates the next message of the context.
+func (r *Receiver) Open(aad, ciphertext []byte) ([]byte, error) {
+	if r.aead == nil {
+		return nil, ErrExportOnly
+	}
+
+	nonce, err := r.nextNonce()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := r.aead.Open(nil, nonce, ciphertext, aad)
+	if err != nil {
+		return nil, ErrOpen
+	}
+	r.seq++
+	return plaintext, nil
+}
+
+func (k KDF) newHash() func() hash.Hash {
+	switch k {
+	case KDFHKDFSHA256:
+		return sha256.New
+	case KDFHKDFSHA512:
+		return sha512.New
+	default:
+		return nil
+	}
+}
+
+func (k KDF) labeledExtract(suiteID, salt []byte, label string, ikm []byte) []byte {
+	labeledIKM := append([]byte("HPKE-v1"), suiteID...)
+	labeledIKM = append(labeledIKM, label...)
+	labeledIKM = append(labeledIKM, ikm...)
+	return hkdf.Extract(k.newHash(), labeledIKM, salt)
+}
+
+func (k KDF) labeledExpand(suiteID, prk []byte, label string, info []byte, length int) ([]byte, error) {
+	labeledInfo := binary.BigEndian.AppendUint16(nil, uint16(length))
+	labeledInfo = append(labeledInfo, "HPKE-v1"...)
+	labeledInfo = append(labeledInfo, suiteID...)
+	labeledInfo = append(labeledInfo, label...)
+	labeledInfo = append(labeledInfo, info...)
+
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.Expand(k.newHash(), prk, labeledInfo), out); err != nil {
+		return nil, fmt.Errorf("hpke: %w", err)
+	}
+	return out, nil
+}
+
+func (a AEAD) keySize() int {
+	switch a {
+	case AEADAES128GCM:
+		return 16
+	default:
+		return 32
+	}
+}
+
+func (a AEAD) new(key []byte) (cipher.AEAD, error) {
+	switch a {
+	case AEADAES128GCM, AEADAES256GCM:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case AEADChaCha20Poly1305:
+		return chacha20poly1305.New(key)
+	default:
+		return nil, ErrUnsupportedSuite
+	}
+}
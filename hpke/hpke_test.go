@@ -0,0 +1,251 @@
+package hpke
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/lyonnee/key25519/x25519"
+)
+
+// testdata/rfc9180-vectors.json holds the DHKEM(X25519, HKDF-SHA256) entries
+// of the RFC 9180 test vectors, trimmed to their first four encryptions.
+type vector struct {
+	Mode        mode   `json:"mode"`
+	KEM         KEM    `json:"kem_id"`
+	KDF         KDF    `json:"kdf_id"`
+	AEAD        AEAD   `json:"aead_id"`
+	Info        string `json:"info"`
+	IkmE        string `json:"ikmE"`
+	IkmR        string `json:"ikmR"`
+	IkmS        string `json:"ikmS"`
+	SkRm        string `json:"skRm"`
+	PkRm        string `json:"pkRm"`
+	PkSm        string `json:"pkSm"`
+	PSK         string `json:"psk"`
+	PSKID       string `json:"psk_id"`
+	Enc         string `json:"enc"`
+	Encryptions []struct {
+		AAD string `json:"aad"`
+		CT  string `json:"ct"`
+		PT  string `json:"pt"`
+	} `json:"encryptions"`
+	Exports []struct {
+		Context string `json:"exporter_context"`
+		L       int    `json:"L"`
+		Value   string `json:"exported_value"`
+	} `json:"exports"`
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRFC9180Vectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/rfc9180-vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		v := v
+		name := fmt.Sprintf("mode %d kdf %04x aead %04x", v.Mode, v.KDF, v.AEAD)
+		t.Run(name, func(t *testing.T) {
+			testVector(t, &v)
+		})
+	}
+}
+
+func testVector(t *testing.T, v *vector) {
+	if v.KEM != DHKEMX25519HKDFSHA256 {
+		t.Fatalf("unexpected KEM %04x", v.KEM)
+	}
+	suite := NewSuite(v.KDF, v.AEAD)
+	info, psk, pskID := mustHex(t, v.Info), mustHex(t, v.PSK), mustHex(t, v.PSKID)
+
+	skR, err := DeriveKeyPair(mustHex(t, v.IkmR))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(skR.PrivateKey, mustHex(t, v.SkRm)) || !bytes.Equal(skR.PublicKey, mustHex(t, v.PkRm)) {
+		t.Fatal("DeriveKeyPair(ikmR) does not match skRm/pkRm")
+	}
+
+	var skS *x25519.KeyPair
+	if v.IkmS != "" {
+		if skS, err = DeriveKeyPair(mustHex(t, v.IkmS)); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(skS.PublicKey, mustHex(t, v.PkSm)) {
+			t.Fatal("DeriveKeyPair(ikmS) does not match pkSm")
+		}
+	}
+
+	// The ephemeral key is derived from the bytes read from rand, so
+	// passing ikmE reproduces the vector.
+	rand := bytes.NewReader(mustHex(t, v.IkmE))
+	var (
+		enc      []byte
+		sender   *Sender
+		receiver *Receiver
+	)
+	switch v.Mode {
+	case modeBase:
+		enc, sender, err = suite.SetupBaseS(rand, skR.PublicKey, info)
+	case modePSK:
+		enc, sender, err = suite.SetupPSKS(rand, skR.PublicKey, info, psk, pskID)
+	case modeAuth:
+		enc, sender, err = suite.SetupAuthS(rand, skR.PublicKey, info, skS)
+	case modeAuthPSK:
+		enc, sender, err = suite.SetupAuthPSKS(rand, skR.PublicKey, info, psk, pskID, skS)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(enc, mustHex(t, v.Enc)) {
+		t.Fatalf("enc = %x, want %s", enc, v.Enc)
+	}
+
+	switch v.Mode {
+	case modeBase:
+		receiver, err = suite.SetupBaseR(enc, skR, info)
+	case modePSK:
+		receiver, err = suite.SetupPSKR(enc, skR, info, psk, pskID)
+	case modeAuth:
+		receiver, err = suite.SetupAuthR(enc, skR, info, skS.PublicKey)
+	case modeAuthPSK:
+		receiver, err = suite.SetupAuthPSKR(enc, skR, info, psk, pskID, skS.PublicKey)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, e := range v.Encryptions {
+		aad, pt := mustHex(t, e.AAD), mustHex(t, e.PT)
+		if v.AEAD == AEADExportOnly {
+			if _, err := sender.Seal(aad, pt); err != ErrExportOnly {
+				t.Fatalf("Seal on export-only context: err = %v, want ErrExportOnly", err)
+			}
+			break
+		}
+
+		ct, err := sender.Seal(aad, pt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(ct, mustHex(t, e.CT)) {
+			t.Fatalf("encryption %d: ct = %x, want %s", i, ct, e.CT)
+		}
+		got, err := receiver.Open(aad, ct)
+		if err != nil {
+			t.Fatalf("encryption %d: %v", i, err)
+		}
+		if !bytes.Equal(got, pt) {
+			t.Fatalf("encryption %d: pt = %x, want %s", i, got, e.PT)
+		}
+	}
+
+	for i, e := range v.Exports {
+		want := mustHex(t, e.Value)
+		got, err := sender.Export(mustHex(t, e.Context), e.L)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("export %d: sender = %x, want %s", i, got, e.Value)
+		}
+		if got, err = receiver.Export(mustHex(t, e.Context), e.L); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("export %d: receiver = %x, want %s", i, got, e.Value)
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	skR, err := DeriveKeyPair([]byte("recipient"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := NewSuite(KDFHKDFSHA256, AEADChaCha20Poly1305)
+
+	enc, sender, err := suite.SetupBaseS(bytes.NewReader(make([]byte, 32)), skR.PublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := suite.SetupBaseR(enc, skR, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ct, err := sender.Seal(nil, []byte("message"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ct[0] ^= 1
+	if _, err := receiver.Open(nil, ct); err != ErrOpen {
+		t.Fatalf("err = %v, want ErrOpen", err)
+	}
+}
+
+func TestExportLength(t *testing.T) {
+	skR, err := DeriveKeyPair([]byte("recipient"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sender, err := NewSuite(KDFHKDFSHA256, AEADExportOnly).SetupBaseS(bytes.NewReader(make([]byte, 32)), skR.PublicKey, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sender.Export(nil, 255*32+1); err == nil {
+		t.Fatal("Export accepted a length above 255*Nh")
+	}
+}
+
+func TestAuthModesRequireSenderKey(t *testing.T) {
+	skR, err := DeriveKeyPair([]byte("recipient"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	skS, err := DeriveKeyPair([]byte("sender"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	suite := NewSuite(KDFHKDFSHA256, AEADAES128GCM)
+	psk, pskID := []byte("0123456789abcdef0123456789abcdef"), []byte("psk id")
+	rand := func() *bytes.Reader { return bytes.NewReader(make([]byte, 32)) }
+
+	if _, _, err := suite.SetupAuthS(rand(), skR.PublicKey, nil, nil); err != ErrMissingSenderKey {
+		t.Errorf("SetupAuthS with nil skS: err = %v, want ErrMissingSenderKey", err)
+	}
+	if _, _, err := suite.SetupAuthPSKS(rand(), skR.PublicKey, nil, psk, pskID, nil); err != ErrMissingSenderKey {
+		t.Errorf("SetupAuthPSKS with nil skS: err = %v, want ErrMissingSenderKey", err)
+	}
+
+	enc, _, err := suite.SetupAuthS(rand(), skR.PublicKey, nil, skS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := suite.SetupAuthR(enc, skR, nil, nil); err != ErrMissingSenderKey {
+		t.Errorf("SetupAuthR with nil pkS: err = %v, want ErrMissingSenderKey", err)
+	}
+	if _, err := suite.SetupAuthPSKR(enc, skR, nil, psk, pskID, []byte{}); err != ErrMissingSenderKey {
+		t.Errorf("SetupAuthPSKR with empty pkS: err = %v, want ErrMissingSenderKey", err)
+	}
+	if _, err := suite.SetupAuthR(enc, skR, nil, skS.PublicKey); err != nil {
+		t.Errorf("SetupAuthR with pkS: %v", err)
+	}
+}
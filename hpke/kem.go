@@ -0,0 +1,124 @@
+package hpke
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+// DHKEM(X25519, HKDF-SHA256) sizes.
+const (
+	nSecret = 32
+	nEnc    = 32
+	nPk     = 32
+	nSk     = 32
+)
+
+var ErrInvalidKey = errors.New("hpke: invalid X25519 key")
+
+func kemSuiteID() []byte {
+	return binary.BigEndian.AppendUint16([]byte("KEM"), uint16(DHKEMX25519HKDFSHA256))
+}
+
+// DeriveKeyPair deterministically derives an X25519 key pair from ikm as
+// specified by DeriveKeyPair in RFC 9180, section 7.1.3.
+func DeriveKeyPair(ikm []byte) (*x25519.KeyPair, error) {
+	h := KDFHKDFSHA256
+	dkpPRK := h.labeledExtract(kemSuiteID(), nil, "dkp_prk", ikm)
+	sk, err := h.labeledExpand(kemSuiteID(), dkpPRK, "sk", nil, nSk)
+	if err != nil {
+		return nil, err
+	}
+
+	pk, err := curve25519.X25519(sk, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &x25519.KeyPair{PrivateKey: sk, PublicKey: pk}, nil
+}
+
+// generateEphemeral derives the ephemeral key from Nsk bytes of rand, which
+// lets test vectors be replayed by passing ikmE as the reader.
+func generateEphemeral(rand io.Reader) (*x25519.KeyPair, error) {
+	ikm := make([]byte, nSk)
+	if _, err := io.ReadFull(rand, ikm); err != nil {
+		return nil, err
+	}
+	return DeriveKeyPair(ikm)
+}
+
+func dh(sk, pk []byte) ([]byte, error) {
+	if len(sk) != nSk || len(pk) != nPk {
+		return nil, ErrInvalidKey
+	}
+	return curve25519.X25519(sk, pk)
+}
+
+func extractAndExpand(dh, kemContext []byte) ([]byte, error) {
+	h := KDFHKDFSHA256
+	eaePRK := h.labeledExtract(kemSuiteID(), nil, "eae_prk", dh)
+	return h.labeledExpand(kemSuiteID(), eaePRK, "shared_secret", kemContext, nSecret)
+}
+
+// encap implements Encap, or AuthEncap when skS is not nil.
+func encap(rand io.Reader, pkR []byte, skS *x25519.KeyPair) (sharedSecret, enc []byte, err error) {
+	ephemeral, err := generateEphemeral(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dhBytes, err := dh(ephemeral.PrivateKey, pkR)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	enc = ephemeral.PublicKey
+	kemContext := append(append([]byte{}, enc...), pkR...)
+
+	if skS != nil {
+		dhS, err := dh(skS.PrivateKey, pkR)
+		if err != nil {
+			return nil, nil, err
+		}
+		dhBytes = append(dhBytes, dhS...)
+		kemContext = append(kemContext, skS.PublicKey...)
+	}
+
+	sharedSecret, err = extractAndExpand(dhBytes, kemContext)
+	if err != nil {
+		return nil, nil, err
+	}
+	return sharedSecret, enc, nil
+}
+
+// decap implements Decap, or AuthDecap when pkS is not nil.
+func decap(enc []byte, skR *x25519.KeyPair, pkS []byte) ([]byte, error) {
+	if len(enc) != nEnc {
+		return nil, ErrInvalidKey
+	}
+
+	dhBytes, err := dh(skR.PrivateKey, enc)
+	if err != nil {
+		return nil, err
+	}
+
+	pkR, err := curve25519.X25519(skR.PrivateKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	kemContext := append(append([]byte{}, enc...), pkR...)
+
+	if pkS != nil {
+		dhS, err := dh(skR.PrivateKey, pkS)
+		if err != nil {
+			return nil, err
+		}
+		dhBytes = append(dhBytes, dhS...)
+		kemContext = append(kemContext, pkS...)
+	}
+
+	return extractAndExpand(dhBytes, kemContext)
+}
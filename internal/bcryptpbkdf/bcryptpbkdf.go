@@ -0,0 +1,103 @@
+// Package bcryptpbkdf implements bcrypt_pbkdf(3) from OpenBSD, the KDF used
+// by OpenSSH to encrypt openssh-key-v1 private keys.
+//
+// golang.org/x/crypto/ssh has its own copy, but it lives under an internal
+// directory and cannot be imported. Delegating to
+// ssh.ParseRawPrivateKeyWithPassphrase is no substitute either, because it
+// discards the comment of the key, which ParseOpenSSHPrivateKey returns, so
+// key25519 decrypts openssh-key-v1 files itself with this package.
+// ssh.MarshalPrivateKeyWithPassphrase could write them, but MarshalOpenSSH
+// uses the same code as the parser so that both agree on the format.
+package bcryptpbkdf
+
+import (
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+
+	"golang.org/x/crypto/blowfish"
+)
+
+const blockSize = 32
+
+// magic is the bcrypt plaintext, "OxychromaticBlowfishSwatDynamite".
+var magic = []byte("OxychromaticBlowfishSwatDynamite")
+
+// Key derives keyLen bytes from password and salt with the given number of
+// rounds.
+func Key(password, salt []byte, rounds, keyLen int) ([]byte, error) {
+	if rounds < 1 {
+		return nil, errors.New("bcryptpbkdf: number of rounds is too small")
+	}
+	if len(password) == 0 {
+		return nil, errors.New("bcryptpbkdf: empty password")
+	}
+	if len(salt) == 0 || len(salt) > 1<<20 {
+		return nil, errors.New("bcryptpbkdf: bad salt length")
+	}
+	if keyLen < 1 || keyLen > 1024 {
+		return nil, errors.New("bcryptpbkdf: bad key length")
+	}
+
+	numBlocks := (keyLen + blockSize - 1) / blockSize
+	key := make([]byte, numBlocks*blockSize)
+
+	h := sha512.New()
+	h.Write(password)
+	shaPass := h.Sum(nil)
+
+	shaSalt := make([]byte, 0, sha512.Size)
+	var cnt [4]byte
+	tmp := make([]byte, blockSize)
+	out := make([]byte, blockSize)
+	for block := 1; block <= numBlocks; block++ {
+		h.Reset()
+		h.Write(salt)
+		binary.BigEndian.PutUint32(cnt[:], uint32(block))
+		h.Write(cnt[:])
+		hash(tmp, shaPass, h.Sum(shaSalt))
+		copy(out, tmp)
+
+		for i := 2; i <= rounds; i++ {
+			h.Reset()
+			h.Write(tmp)
+			hash(tmp, shaPass, h.Sum(shaSalt))
+			for j := range out {
+				out[j] ^= tmp[j]
+			}
+		}
+
+		// Output bytes are interleaved across blocks rather than
+		// concatenated.
+		for i, v := range out {
+			key[i*numBlocks+block-1] = v
+		}
+	}
+	return key[:keyLen], nil
+}
+
+// hash is the bcrypt core with an expensive key schedule keyed by the
+// hashed password and salt.
+func hash(out, shaPass, shaSalt []byte) {
+	c, err := blowfish.NewSaltedCipher(shaPass, shaSalt)
+	if err != nil {
+		panic(err)
+	}
+	for i := 0; i < 64; i++ {
+		blowfish.ExpandKey(shaSalt, c)
+		blowfish.ExpandKey(shaPass, c)
+	}
+
+	copy(out, magic)
+	for i := 0; i < blockSize; i += blowfish.BlockSize {
+		for j := 0; j < 64; j++ {
+			c.Encrypt(out[i:i+blowfish.BlockSize], out[i:i+blowfish.BlockSize])
+		}
+	}
+
+	// Blowfish works on big-endian words; bcrypt_pbkdf emits them
+	// little-endian.
+	for i := 0; i < blockSize; i += 4 {
+		out[i], out[i+1], out[i+2], out[i+3] = out[i+3], out[i+2], out[i+1], out[i]
+	}
+}
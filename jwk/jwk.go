@@ -0,0 +1,320 @@
+// Package jwk converts key25519 and X25519 keys to and from JSON Web Keys of
+// the OKP key type (RFC 8037), parses JWK Sets (RFC 7517) and computes JWK
+// thumbprints (RFC 7638).
+package jwk
+
+import (
+	"bytes"
+	"crypto"
+	_ "crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/lyonnee/key25519"
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	KeyTypeOKP   = "OKP"
+	CurveEd25519 = "Ed25519"
+	CurveX25519  = "X25519"
+
+	// AlgEdDSA is the JWS "alg" of Ed25519 signatures.
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrUnsupportedKey = errors.New("jwk: unsupported key type or curve")
+	ErrInvalidKey     = errors.New("jwk: invalid key material")
+	ErrNoPrivateKey   = errors.New("jwk: key has no private part")
+	ErrKeyNotFound    = errors.New("jwk: key ID not found in set")
+)
+
+var b64 = base64.RawURLEncoding
+
+// Key is an OKP JSON Web Key. X and D hold the raw key bytes; they are
+// base64url-encoded on the wire.
+type Key struct {
+	KeyType   string   `json:"kty"`
+	Curve     string   `json:"crv"`
+	X         []byte   `json:"-"`
+	D         []byte   `json:"-"`
+	KeyID     string   `json:"kid,omitempty"`
+	Use       string   `json:"use,omitempty"`
+	Algorithm string   `json:"alg,omitempty"`
+	KeyOps    []string `json:"key_ops,omitempty"`
+}
+
+func (k Key) MarshalJSON() ([]byte, error) {
+	type plain Key
+	v := struct {
+		plain
+		X string `json:"x"`
+		D string `json:"d,omitempty"`
+	}{plain(k), b64.EncodeToString(k.X), b64.EncodeToString(k.D)}
+	return json.Marshal(v)
+}
+
+func (k *Key) UnmarshalJSON(data []byte) error {
+	type plain Key
+	var v struct {
+		plain
+		X *string `json:"x"`
+		D *string `json:"d"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if !supported(v.KeyType, v.Curve) {
+		return fmt.Errorf("%w: kty %q, crv %q", ErrUnsupportedKey, v.KeyType, v.Curve)
+	}
+	if v.X == nil {
+		return fmt.Errorf("%w: missing \"x\"", ErrInvalidKey)
+	}
+
+	key := Key(v.plain)
+	var err error
+	if key.X, err = b64.DecodeString(*v.X); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if v.D != nil {
+		if key.D, err = b64.DecodeString(*v.D); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+	}
+	if err := key.validate(); err != nil {
+		return err
+	}
+
+	*k = key
+	return nil
+}
+
+func (k *Key) validate() error {
+	if !supported(k.KeyType, k.Curve) {
+		return fmt.Errorf("%w: kty %q, crv %q", ErrUnsupportedKey, k.KeyType, k.Curve)
+	}
+	if len(k.X) != 32 || (k.D != nil && len(k.D) != 32) {
+		return fmt.Errorf("%w: wrong key length", ErrInvalidKey)
+	}
+	return nil
+}
+
+func supported(kty, crv string) bool {
+	return kty == KeyTypeOKP && (crv == CurveEd25519 || crv == CurveX25519)
+}
+
+// ParseKey parses a single OKP JWK.
+func ParseKey(data []byte) (*Key, error) {
+	var k Key
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// FromPublicKey returns the Ed25519 JWK of pk.
+func FromPublicKey(pk key25519.PublicKey) *Key {
+	return &Key{
+		KeyType: KeyTypeOKP,
+		Curve:   CurveEd25519,
+		X:       bytes.Clone(pk.Bytes()),
+	}
+}
+
+// FromPrivateKey returns the Ed25519 JWK of pk, with D set to its seed.
+func FromPrivateKey(pk key25519.PrivateKey) *Key {
+	k := FromPublicKey(pk.GetPubKey())
+	k.D = pk.ToEd25519PrivKey().Seed()
+	return k
+}
+
+// FromX25519PublicKey returns the X25519 JWK of a raw X25519 public key.
+func FromX25519PublicKey(pubKey []byte) (*Key, error) {
+	if len(pubKey) != curve25519.PointSize {
+		return nil, ErrInvalidKey
+	}
+	return &Key{
+		KeyType: KeyTypeOKP,
+		Curve:   CurveX25519,
+		X:       bytes.Clone(pubKey),
+	}, nil
+}
+
+// FromX25519KeyPair returns the X25519 JWK of kp, including its private key.
+func FromX25519KeyPair(kp *x25519.KeyPair) (*Key, error) {
+	k, err := FromX25519PublicKey(kp.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(kp.PrivateKey) != curve25519.ScalarSize {
+		return nil, ErrInvalidKey
+	}
+	k.D = bytes.Clone(kp.PrivateKey)
+	return k, nil
+}
+
+// IsPrivate reports whether the key has a private part.
+func (k *Key) IsPrivate() bool {
+	return k.D != nil
+}
+
+// Public returns a copy of the key without its private part.
+func (k *Key) Public() *Key {
+	pub := *k
+	pub.D = nil
+	return &pub
+}
+
+// PublicKey returns the key25519 public key of an Ed25519 JWK.
+func (k *Key) PublicKey() (key25519.PublicKey, error) {
+	if err := k.expect(CurveEd25519); err != nil {
+		return key25519.PublicKey{}, err
+	}
+	return key25519.NewPubKeyFromEd25119PubKey(k.X)
+}
+
+// PrivateKey returns the key25519 private key of an Ed25519 JWK. The "x"
+// member must match the public key derived from "d".
+func (k *Key) PrivateKey() (key25519.PrivateKey, error) {
+	if err := k.expect(CurveEd25519); err != nil {
+		return key25519.PrivateKey{}, err
+	}
+	if !k.IsPrivate() {
+		return key25519.PrivateKey{}, ErrNoPrivateKey
+	}
+
+	privKey, err := key25519.NewPrivateKeyFromSeed(k.D)
+	if err != nil {
+		return key25519.PrivateKey{}, err
+	}
+	if !bytes.Equal(privKey.GetPubKey().Bytes(), k.X) {
+		return key25519.PrivateKey{}, key25519.ErrKeyMismatch
+	}
+	return privKey, nil
+}
+
+// KeyPair returns the key25519 key pair of a private Ed25519 JWK.
+func (k *Key) KeyPair() (*key25519.KeyPair, error) {
+	privKey, err := k.PrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return key25519.NewKeyPairFromPrivKeyBytes(privKey.Bytes())
+}
+
+// X25519PublicKey returns the raw public key of an X25519 JWK.
+func (k *Key) X25519PublicKey() ([]byte, error) {
+	if err := k.expect(CurveX25519); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(k.X), nil
+}
+
+// X25519KeyPair returns the key pair of a private X25519 JWK. The "x"
+// member must match the public key derived from "d".
+func (k *Key) X25519KeyPair() (*x25519.KeyPair, error) {
+	if err := k.expect(CurveX25519); err != nil {
+		return nil, err
+	}
+	if !k.IsPrivate() {
+		return nil, ErrNoPrivateKey
+	}
+
+	pubKey, err := curve25519.X25519(k.D, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pubKey, k.X) {
+		return nil, key25519.ErrKeyMismatch
+	}
+	return &x25519.KeyPair{
+		PrivateKey: bytes.Clone(k.D),
+		PublicKey:  pubKey,
+	}, nil
+}
+
+func (k *Key) expect(crv string) error {
+	if err := k.validate(); err != nil {
+		return err
+	}
+	if k.Curve != crv {
+		return fmt.Errorf("%w: expected crv %q, got %q", ErrUnsupportedKey, crv, k.Curve)
+	}
+	return nil
+}
+
+// Thumbprint computes the RFC 7638 thumbprint of the key with hash h, over
+// the required members crv, kty and x only.
+func (k *Key) Thumbprint(h crypto.Hash) ([]byte, error) {
+	if err := k.validate(); err != nil {
+		return nil, err
+	}
+	if !h.Available() {
+		return nil, fmt.Errorf("jwk: hash function %v is not available", h)
+	}
+
+	// Members in lexicographic order, no whitespace; all values are
+	// plain ASCII so no escaping is needed.
+	canonical := fmt.Sprintf(`{"crv":"%s","kty":"%s","x":"%s"}`, k.Curve, k.KeyType, b64.EncodeToString(k.X))
+
+	hh := h.New()
+	hh.Write([]byte(canonical))
+	return hh.Sum(nil), nil
+}
+
+// ThumbprintKeyID returns the base64url SHA-256 thumbprint of the key, the
+// customary "kid" value.
+func (k *Key) ThumbprintKeyID() (string, error) {
+	t, err := k.Thumbprint(crypto.SHA256)
+	if err != nil {
+		return "", err
+	}
+	return b64.EncodeToString(t), nil
+}
+
+// Set is a JWK Set.
+type Set struct {
+	Keys []*Key `json:"keys"`
+}
+
+// ParseSet parses a JWK Set. As RFC 7517 section 5 asks, keys of other types
+// or curves, such as the RSA keys many identity providers publish alongside,
+// are skipped; malformed OKP keys are an error.
+func ParseSet(data []byte) (*Set, error) {
+	var raw struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	if raw.Keys == nil {
+		return nil, errors.New("jwk: missing \"keys\" member")
+	}
+
+	set := &Set{}
+	for _, r := range raw.Keys {
+		k, err := ParseKey(r)
+		if errors.Is(err, ErrUnsupportedKey) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		set.Keys = append(set.Keys, k)
+	}
+	return set, nil
+}
+
+// LookupKeyID returns the first key in the set with the given "kid".
+func (s *Set) LookupKeyID(kid string) (*Key, error) {
+	for _, k := range s.Keys {
+		if k.KeyID == kid {
+			return k, nil
+		}
+	}
+	return nil, ErrKeyNotFound
+}
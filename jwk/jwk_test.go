@@ -0,0 +1,225 @@
+package jwk
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/lyonnee/key25519"
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+// Keys from RFC 8037, Appendix A.
+const (
+	rfc8037Private = `{"kty":"OKP","crv":"Ed25519",
+	 "d":"nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A",
+	 "x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`
+	rfc8037Public = `{"kty":"OKP","crv":"Ed25519",
+	 "x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}`
+	rfc8037Thumbprint = "kPrK_qmxVWaYVA9wwBF6Iuo3vVzz7TxHCTwXBygrS4k"
+
+	// Appendix A.6: Bob's public key and the ephemeral key pair.
+	rfc8037X25519Public    = `{"kty":"OKP","crv":"X25519","kid":"Bob","x":"3p7bfXt9wbTTW2HC7OQ1Nz-DQ8hbeGdNrfx-FG-IK08"}`
+	rfc8037X25519Ephemeral = `{"kty":"OKP","crv":"X25519",
+	 "d":"dwdtCnMYpX08FsFyUbJmRd9ML4frwJkqsXf7pR25LCo",
+	 "x":"hSDwCYkwp1R0i33ctD73Wg2_Og0mOBr066SpjqqbTmo"}`
+	rfc8037SharedSecret = "4a5d9d5ba4ce2de1728e3bf480350f25e07e21c947d19e3376f09b3c1e161742"
+
+	rfc8032Seed   = "9d61b19deffd5a60ba844af492ec2cc44449c5697b326919703bac031cae7f60"
+	rfc8032Public = "d75a980182b10ab7d54bfed3c964073a0ee172f3daa62325af021a68f707511a"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestRFC8037Ed25519(t *testing.T) {
+	k, err := ParseKey([]byte(rfc8037Private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp, err := k.KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(kp.PrivateKey().ToEd25519PrivKey().Seed()); got != rfc8032Seed {
+		t.Errorf("seed = %s, want %s", got, rfc8032Seed)
+	}
+	if got := hex.EncodeToString(kp.PublicKey().Bytes()); got != rfc8032Public {
+		t.Errorf("public key = %s, want %s", got, rfc8032Public)
+	}
+
+	pub, err := ParseKey([]byte(rfc8037Public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pub.IsPrivate() {
+		t.Error("public JWK parsed as private")
+	}
+	if _, err := pub.PrivateKey(); !errors.Is(err, ErrNoPrivateKey) {
+		t.Errorf("PrivateKey of a public JWK: got %v, want ErrNoPrivateKey", err)
+	}
+	pk, err := pub.PublicKey()
+	if err != nil || pk != kp.PublicKey() {
+		t.Fatalf("public JWK: %v", err)
+	}
+
+	for _, key := range []*Key{k, pub} {
+		kid, err := key.ThumbprintKeyID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kid != rfc8037Thumbprint {
+			t.Errorf("thumbprint = %s, want %s", kid, rfc8037Thumbprint)
+		}
+	}
+
+	// Export reproduces the vectors member for member.
+	assertJSONEqual(t, FromPrivateKey(kp.PrivateKey()), rfc8037Private)
+	assertJSONEqual(t, FromPublicKey(kp.PublicKey()), rfc8037Public)
+	assertJSONEqual(t, k.Public(), rfc8037Public)
+}
+
+func TestRFC8037X25519(t *testing.T) {
+	bob, err := ParseKey([]byte(rfc8037X25519Public))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobPub, err := bob.X25519PublicKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := bob.PublicKey(); !errors.Is(err, ErrUnsupportedKey) {
+		t.Errorf("Ed25519 PublicKey of an X25519 JWK: got %v, want ErrUnsupportedKey", err)
+	}
+
+	eph, err := ParseKey([]byte(rfc8037X25519Ephemeral))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kp, err := eph.X25519KeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	z, err := curve25519.X25519(kp.PrivateKey, bobPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(z); got != rfc8037SharedSecret {
+		t.Errorf("shared secret = %s, want %s", got, rfc8037SharedSecret)
+	}
+
+	exported, err := FromX25519KeyPair(kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertJSONEqual(t, exported, rfc8037X25519Ephemeral)
+	exportedPub, err := FromX25519PublicKey(bobPub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exportedPub.KeyID = "Bob"
+	assertJSONEqual(t, exportedPub, rfc8037X25519Public)
+}
+
+func TestParseSetSkipsOtherKeyTypes(t *testing.T) {
+	set, err := ParseSet([]byte(`{"keys":[
+		{"kty":"RSA","kid":"rsa","n":"0vx7agoebGcQSuuPiLJXZpt","e":"AQAB"},
+		{"kty":"EC","kid":"ec","crv":"P-256","x":"f83OJ3D2xF1Bg8vub9tLe1gHMzV76e8Tus9uPHvRVEU","y":"x_FEzRu9m36HLN_tue659LNpXW6pCyStikYjKIWI5a0"},
+		{"kty":"OKP","kid":"x448","crv":"X448","x":"AAAA"},
+		{"kty":"OKP","kid":"ed","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 {
+		t.Fatalf("got %d keys, want 1", len(set.Keys))
+	}
+	if _, err := set.LookupKeyID("ed"); err != nil {
+		t.Error(err)
+	}
+	if _, err := set.LookupKeyID("rsa"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("LookupKeyID(rsa): got %v, want ErrKeyNotFound", err)
+	}
+
+	// Malformed OKP keys are not skipped.
+	if _, err := ParseSet([]byte(`{"keys":[{"kty":"OKP","crv":"Ed25519","x":"AAAA"}]}`)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("malformed OKP key in set: got %v, want ErrInvalidKey", err)
+	}
+}
+
+func TestMismatchedPrivateKey(t *testing.T) {
+	other := key25519.NewKeyPair()
+	k, err := ParseKey([]byte(rfc8037Private))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.D = other.PrivateKey().ToEd25519PrivKey().Seed()
+	if _, err := k.PrivateKey(); !errors.Is(err, key25519.ErrKeyMismatch) {
+		t.Errorf("Ed25519: got %v, want ErrKeyMismatch", err)
+	}
+
+	xkp, err := other.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		t.Fatal(err)
+	}
+	eph, err := ParseKey([]byte(rfc8037X25519Ephemeral))
+	if err != nil {
+		t.Fatal(err)
+	}
+	eph.D = xkp.PrivateKey
+	if _, err := eph.X25519KeyPair(); !errors.Is(err, key25519.ErrKeyMismatch) {
+		t.Errorf("X25519: got %v, want ErrKeyMismatch", err)
+	}
+}
+
+func TestParseKeyRejects(t *testing.T) {
+	const x = "11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHURo"
+	tests := []struct {
+		name, json string
+		want       error
+	}{
+		{"unknown crv", `{"kty":"OKP","crv":"Ed448","x":"` + x + `"}`, ErrUnsupportedKey},
+		{"wrong kty", `{"kty":"EC","crv":"Ed25519","x":"` + x + `"}`, ErrUnsupportedKey},
+		{"short x", `{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcH"}`, ErrInvalidKey},
+		{"long x", `{"kty":"OKP","crv":"X25519","x":"` + x + `AAAA"}`, ErrInvalidKey},
+		{"short d", `{"kty":"OKP","crv":"Ed25519","x":"` + x + `","d":"nWGxne_9WmC6hEr0kuwsxERJxWl7MmkZ"}`, ErrInvalidKey},
+		{"missing x", `{"kty":"OKP","crv":"Ed25519"}`, ErrInvalidKey},
+		{"bad base64", `{"kty":"OKP","crv":"Ed25519","x":"11qYAYKxCrfVS_7TyWQHOg7hcvPapiMlrwIaaPcHUR+"}`, ErrInvalidKey},
+	}
+	for _, tt := range tests {
+		if _, err := ParseKey([]byte(tt.json)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// assertJSONEqual compares the JSON encoding of k with want, ignoring
+// whitespace and member order.
+func assertJSONEqual(t *testing.T, k *Key, want string) {
+	t.Helper()
+	got, err := json.Marshal(k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var g, w map[string]any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	gj, _ := json.Marshal(g)
+	wj, _ := json.Marshal(w)
+	if !bytes.Equal(gj, wj) {
+		t.Errorf("JWK = %s, want %s", gj, wj)
+	}
+}
@@ -1,14 +1,31 @@
 package key25519
 
-import "github.com/lyonnee/key25519/keystore"
+import (
+	"crypto/rand"
+	"io"
+
+	"github.com/lyonnee/key25519/keystore"
+)
 
 type KeyPair struct {
 	privKey PrivateKey
 	pubKey  PublicKey
 }
 
+// NewKeyPair generates a random key pair from crypto/rand. It panics only if
+// the system entropy source fails; use GenerateKeyPair to handle that case.
 func NewKeyPair() *KeyPair {
-	privKey := NewPrivateKey(nil)
+	kp, err := GenerateKeyPair(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+
+	return kp
+}
+
+// Deprecated: it panics on a malformed seed. Use NewKeyPairFromSeed instead.
+func NewKeyPairWithSeed(seed []byte) *KeyPair {
+	privKey := NewPrivateKey(seed)
 
 	return &KeyPair{
 		privKey: privKey,
@@ -16,13 +33,31 @@ func NewKeyPair() *KeyPair {
 	}
 }
 
-func NewKeyPairWithSeed(seed []byte) *KeyPair {
-	privKey := NewPrivateKey(seed)
+// GenerateKeyPair generates a key pair from the given entropy source, which
+// lets tests inject deterministic randomness.
+func GenerateKeyPair(rand io.Reader) (*KeyPair, error) {
+	privKey, err := GeneratePrivateKey(rand)
+	if err != nil {
+		return nil, err
+	}
 
 	return &KeyPair{
 		privKey: privKey,
 		pubKey:  privKey.GetPubKey(),
+	}, nil
+}
+
+// NewKeyPairFromSeed derives the key pair of a 32-byte Ed25519 seed.
+func NewKeyPairFromSeed(seed []byte) (*KeyPair, error) {
+	privKey, err := NewPrivateKeyFromSeed(seed)
+	if err != nil {
+		return nil, err
 	}
+
+	return &KeyPair{
+		privKey: privKey,
+		pubKey:  privKey.GetPubKey(),
+	}, nil
 }
 
 func NewKeyPairFromPrivKeyBytes(key []byte) (*KeyPair, error) {
@@ -64,3 +99,8 @@ func (kp *KeyPair) LoadFromPrivKey(privKey PrivateKey) {
 func (kp *KeyPair) ExportKeystore(filepath, password string) error {
 	return keystore.SaveAsKeystore(kp.PrivateKey().Bytes(), filepath, password, false)
 }
+
+// 按指定的加密参数导出keystore文件
+func (kp *KeyPair) ExportKeystoreWithOptions(filepath, password string, opts *keystore.Options) error {
+	return keystore.SaveAsKeystoreWithOptions(kp.PrivateKey().Bytes(), filepath, password, opts)
+}
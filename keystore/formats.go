@@ -0,0 +1,450 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+	"golang.org/x/text/unicode/norm"
+)
+
+// keystore文件格式，写入时由Options.Format选择，读取时自动识别
+type Format int
+
+const (
+	// 本包带版本号的格式
+	FormatNative Format = iota
+	// 以太坊Web3 Secret Storage v3，Keccak-256 MAC，scrypt或PBKDF2
+	FormatWeb3V3
+	// 以太坊验证者工具使用的EIP-2335(版本4)格式
+	FormatEIP2335
+)
+
+// The Web3 v3 and EIP-2335 formats hold a 32-byte secret: an Ed25519 private
+// key is stored as its seed and loaded back as the full 64-byte key.
+
+type web3Keystore struct {
+	Crypto  cryptoJson `json:"crypto"`
+	ID      string     `json:"id"`
+	Version int        `json:"version"`
+}
+
+type eip2335Module struct {
+	Function string                 `json:"function"`
+	Params   map[string]interface{} `json:"params"`
+	Message  string                 `json:"message"`
+}
+
+type eip2335Keystore struct {
+	Crypto struct {
+		KDF      eip2335Module `json:"kdf"`
+		Checksum eip2335Module `json:"checksum"`
+		Cipher   eip2335Module `json:"cipher"`
+	} `json:"crypto"`
+	Description string `json:"description,omitempty"`
+	PubKey      string `json:"pubkey"`
+	Path        string `json:"path"`
+	UUID        string `json:"uuid"`
+	Version     int    `json:"version"`
+}
+
+// detectFormat tells the formats apart by their version field; native
+// keystores use versions below 3.
+func detectFormat(data []byte) (Format, error) {
+	var v struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return 0, err
+	}
+
+	switch v.Version {
+	case 3:
+		return FormatWeb3V3, nil
+	case 4:
+		return FormatEIP2335, nil
+	default:
+		return FormatNative, nil
+	}
+}
+
+// loadKeystore decrypts a keystore file of any supported format.
+func loadKeystore(data []byte, password string) ([]byte, error) {
+	format, err := detectFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatWeb3V3:
+		return decryptWeb3(data, password)
+	case FormatEIP2335:
+		return decryptEIP2335(data, password)
+	}
+
+	var ks = new(Keystore)
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, err
+	}
+	return ks.Decrypt(password)
+}
+
+// reencryptKeystore decrypts a keystore file of any supported format with
+// oldPassword and encrypts it again under newPassword in the same format,
+// keeping its metadata. A nil opts keeps the file's KDF and cipher settings,
+// except that native files move from aes-128-ctr to aes-256-gcm.
+func reencryptKeystore(data []byte, oldPassword, newPassword string, opts *Options) ([]byte, error) {
+	format, err := detectFormat(data)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatWeb3V3:
+		var ks web3Keystore
+		if err := json.Unmarshal(data, &ks); err != nil {
+			return nil, err
+		}
+		key, err := decryptWeb3(data, oldPassword)
+		if err != nil {
+			return nil, err
+		}
+		defer wipe(key)
+
+		newOpts, err := reencryptOptions(FormatWeb3V3, ks.Crypto, opts)
+		if err != nil {
+			return nil, err
+		}
+		return encryptWeb3(key, newPassword, newOpts, ks.ID)
+	case FormatEIP2335:
+		var ks eip2335Keystore
+		if err := json.Unmarshal(data, &ks); err != nil {
+			return nil, err
+		}
+		key, err := decryptEIP2335(data, oldPassword)
+		if err != nil {
+			return nil, err
+		}
+		defer wipe(key)
+
+		kdf := cryptoJson{Cipher: CipherAES128CTR, KDF: ks.Crypto.KDF.Function, KDFParams: ks.Crypto.KDF.Params}
+		newOpts, err := reencryptOptions(FormatEIP2335, kdf, opts)
+		if err != nil {
+			return nil, err
+		}
+		return encryptEIP2335(key, newPassword, newOpts, &ks)
+	}
+
+	var ks = new(Keystore)
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, err
+	}
+	key, err := ks.Decrypt(oldPassword)
+	if err != nil {
+		return nil, err
+	}
+	defer wipe(key)
+
+	newOpts, err := reencryptOptions(FormatNative, ks.Crypto, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// 旧格式没有元数据，顺带升级为当前版本
+	if ks.IsLegacy() {
+		newKs, err := newKeystore(key, newPassword, newOpts)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(newKs)
+	}
+
+	if err := ks.encrypt(key, newPassword, newOpts); err != nil {
+		return nil, err
+	}
+	return json.Marshal(ks)
+}
+
+// reencryptOptions returns opts, or options reproducing c if opts is nil.
+// Format and Label never change on re-encryption. Native files written with
+// aes-128-ctr are upgraded to aes-256-gcm, as in Migrate, since ctr does not
+// authenticate their metadata; the other formats only define ctr.
+func reencryptOptions(format Format, c cryptoJson, opts *Options) (*Options, error) {
+	if opts == nil {
+		o, err := optionsFromCrypto(c)
+		if err != nil {
+			return nil, err
+		}
+		if format == FormatNative && o.Cipher == CipherAES128CTR {
+			o.Cipher = CipherAES256GCM
+		}
+		return o, nil
+	}
+
+	o := *opts
+	o.Format = FormatNative
+	o.Label = ""
+	return &o, nil
+}
+
+// wipe zeroes key material once it is no longer needed.
+func wipe(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// marshalKeystore encrypts key into a new file in the format selected by
+// opts.
+func marshalKeystore(key []byte, password string, opts *Options) ([]byte, error) {
+	switch opts.format() {
+	case FormatNative:
+		ks, err := newKeystore(key, password, opts)
+		if err != nil {
+			return nil, err
+		}
+		return json.Marshal(ks)
+	case FormatWeb3V3:
+		return encryptWeb3(key, password, opts, "")
+	case FormatEIP2335:
+		return encryptEIP2335(key, password, opts, nil)
+	}
+	return nil, fmt.Errorf("unsupported keystore format: %d", opts.format())
+}
+
+// encryptWeb3 writes a Web3 v3 keystore with the given id, or a new one if
+// id is empty.
+func encryptWeb3(key []byte, password string, opts *Options, id string) ([]byte, error) {
+	derivedKey, c, err := deriveLegacyKey([]byte(password), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	iv, cipherText, err := encryptCTR(derivedKey, secretOf(key))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Cipher = CipherAES128CTR
+	c.CipherText = hex.EncodeToString(cipherText)
+	c.CipherParams.IV = hex.EncodeToString(iv)
+	c.MAC = hex.EncodeToString(keccak256(derivedKey[16:32], cipherText))
+
+	if id == "" {
+		if id, err = newUUID(); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(web3Keystore{Crypto: c, ID: id, Version: 3})
+}
+
+func decryptWeb3(data []byte, password string) ([]byte, error) {
+	var ks web3Keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, err
+	}
+	if ks.Crypto.Cipher != CipherAES128CTR {
+		return nil, fmt.Errorf("cipher not supported: %v", ks.Crypto.Cipher)
+	}
+
+	mac, err := hex.DecodeString(ks.Crypto.MAC)
+	if err != nil {
+		return nil, err
+	}
+	iv, err := hex.DecodeString(ks.Crypto.CipherParams.IV)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(ks.Crypto.CipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := getKDFKey(ks.Crypto, password)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(keccak256(derivedKey[16:32], cipherText), mac) {
+		return nil, ErrDecrypt
+	}
+
+	secret, err := aesCTRXOR(derivedKey[:16], cipherText, iv)
+	if err != nil {
+		return nil, err
+	}
+	return keyOf(secret), nil
+}
+
+// encryptEIP2335 writes an EIP-2335 keystore. The description, pubkey, path
+// and uuid are taken from prev if it is non-nil, and generated otherwise.
+func encryptEIP2335(key []byte, password string, opts *Options, prev *eip2335Keystore) ([]byte, error) {
+	derivedKey, c, err := deriveLegacyKey(eip2335Password(password), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := secretOf(key)
+	iv, cipherText, err := encryptCTR(derivedKey, secret)
+	if err != nil {
+		return nil, err
+	}
+	checksum := sha256.Sum256(append(derivedKey[16:32:32], cipherText...))
+
+	var ks eip2335Keystore
+	if prev != nil {
+		ks = *prev
+	} else {
+		if pubKey := publicKeyOf(keyOf(secret)); pubKey != nil {
+			ks.PubKey = hex.EncodeToString(pubKey)
+		}
+		if opts != nil {
+			ks.Description = opts.Label
+		}
+		if ks.UUID, err = newUUID(); err != nil {
+			return nil, err
+		}
+	}
+	ks.Version = 4
+	ks.Crypto.KDF = eip2335Module{Function: c.KDF, Params: c.KDFParams}
+	ks.Crypto.Checksum = eip2335Module{
+		Function: "sha256",
+		Params:   map[string]interface{}{},
+		Message:  hex.EncodeToString(checksum[:]),
+	}
+	ks.Crypto.Cipher = eip2335Module{
+		Function: CipherAES128CTR,
+		Params:   map[string]interface{}{"iv": hex.EncodeToString(iv)},
+		Message:  hex.EncodeToString(cipherText),
+	}
+
+	return json.Marshal(ks)
+}
+
+func decryptEIP2335(data []byte, password string) ([]byte, error) {
+	var ks eip2335Keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		return nil, err
+	}
+	if ks.Crypto.Cipher.Function != CipherAES128CTR {
+		return nil, fmt.Errorf("cipher not supported: %v", ks.Crypto.Cipher.Function)
+	}
+	if ks.Crypto.Checksum.Function != "sha256" {
+		return nil, fmt.Errorf("checksum not supported: %v", ks.Crypto.Checksum.Function)
+	}
+
+	checksum, err := hex.DecodeString(ks.Crypto.Checksum.Message)
+	if err != nil {
+		return nil, err
+	}
+	ivHex, _ := ks.Crypto.Cipher.Params["iv"].(string)
+	iv, err := hex.DecodeString(ivHex)
+	if err != nil {
+		return nil, err
+	}
+	cipherText, err := hex.DecodeString(ks.Crypto.Cipher.Message)
+	if err != nil {
+		return nil, err
+	}
+
+	kdf := cryptoJson{KDF: ks.Crypto.KDF.Function, KDFParams: ks.Crypto.KDF.Params}
+	derivedKey, err := getKDFKey(kdf, string(eip2335Password(password)))
+	if err != nil {
+		return nil, err
+	}
+	calculated := sha256.Sum256(append(derivedKey[16:32:32], cipherText...))
+	if !hmac.Equal(calculated[:], checksum) {
+		return nil, ErrDecrypt
+	}
+
+	secret, err := aesCTRXOR(derivedKey[:16], cipherText, iv)
+	if err != nil {
+		return nil, err
+	}
+	return keyOf(secret), nil
+}
+
+// deriveLegacyKey runs the KDF for the Web3 v3 and EIP-2335 formats, which
+// only define scrypt and PBKDF2 with aes-128-ctr. New files use scrypt.
+func deriveLegacyKey(password []byte, opts *Options) ([]byte, cryptoJson, error) {
+	salt := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, cryptoJson{}, fmt.Errorf("reading from crypto/rand failed: %w", err)
+	}
+
+	kdfOpts := Options{KDF: KDFScrypt}
+	if opts != nil {
+		kdfOpts = *opts
+		if kdfOpts.KDF == "" {
+			kdfOpts.KDF = KDFScrypt
+		}
+	}
+	if kdfOpts.KDF != KDFScrypt {
+		return nil, cryptoJson{}, fmt.Errorf("unsupported KDF for this keystore format: %s", kdfOpts.KDF)
+	}
+	if kdfOpts.Cipher != "" && kdfOpts.Cipher != CipherAES128CTR {
+		return nil, cryptoJson{}, fmt.Errorf("unsupported cipher for this keystore format: %s", kdfOpts.Cipher)
+	}
+
+	kdf, kdfParams, derivedKey, err := deriveKey(password, salt, &kdfOpts)
+	if err != nil {
+		return nil, cryptoJson{}, err
+	}
+	return derivedKey, cryptoJson{KDF: kdf, KDFParams: kdfParams}, nil
+}
+
+// encryptCTR encrypts data with aes-128-ctr under the first half of the
+// derived key and a random IV.
+func encryptCTR(derivedKey, data []byte) ([]byte, []byte, error) {
+	iv := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, fmt.Errorf("reading from crypto/rand failed: %w", err)
+	}
+
+	cipherText, err := aesCTRXOR(derivedKey[:16], data, iv)
+	if err != nil {
+		return nil, nil, err
+	}
+	return iv, cipherText, nil
+}
+
+func keccak256(data ...[]byte) []byte {
+	h := sha3.NewLegacyKeccak256()
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+// eip2335Password normalizes the password as EIP-2335 requires: NFKD, then
+// strip the C0, C1 and Delete control codes.
+func eip2335Password(password string) []byte {
+	return []byte(strings.Map(func(r rune) rune {
+		if r < 0x20 || (r >= 0x7f && r <= 0x9f) {
+			return -1
+		}
+		return r
+	}, norm.NFKD.String(password)))
+}
+
+// secretOf returns the seed of an Ed25519 private key, or key unchanged.
+func secretOf(key []byte) []byte {
+	if publicKeyOf(key) != nil {
+		return ed25519.PrivateKey(key).Seed()
+	}
+	return key
+}
+
+// keyOf expands a 32-byte secret to the Ed25519 private key it seeds.
+func keyOf(secret []byte) []byte {
+	if len(secret) == ed25519.SeedSize {
+		return ed25519.NewKeyFromSeed(secret)
+	}
+	return secret
+}
@@ -0,0 +1,218 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Test vectors from the Web3 Secret Storage definition.
+const (
+	web3ScryptVector = `{
+		"crypto": {
+			"cipher": "aes-128-ctr",
+			"cipherparams": {"iv": "83dbcc02d8ccb40e466191a123791e0e"},
+			"ciphertext": "d172bf743a674da9cdad04534d56926ef8358534d458fffccd4e6ad2fbde479c",
+			"kdf": "scrypt",
+			"kdfparams": {
+				"dklen": 32,
+				"n": 262144,
+				"r": 1,
+				"p": 8,
+				"salt": "ab0c7876052600dd703518d6fc3fe8984592145b591fc8fb5c6d43190334ba19"
+			},
+			"mac": "2103ac29920d71da29f15d75b4a16dbe95cfd7ff8faea1056c33131d846e3097"
+		},
+		"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version": 3
+	}`
+	web3PBKDF2Vector = `{
+		"crypto": {
+			"cipher": "aes-128-ctr",
+			"cipherparams": {"iv": "6087dab2f9fdbbfaddc31a909735c1e6"},
+			"ciphertext": "5318b4d5bcd28de64ee5559e671353e16f075ecae9f99c7a79a38af5f869aa46",
+			"kdf": "pbkdf2",
+			"kdfparams": {
+				"c": 262144,
+				"dklen": 32,
+				"prf": "hmac-sha256",
+				"salt": "ae3cd4e7013836a3df6bd7241b12db061dbe2c6785853cce422d148a624ce0bd"
+			},
+			"mac": "517ead924a9d0dc3124507e3393d175ce3ff7c1e96529c6c555ce9e51205e9b2"
+		},
+		"id": "3198bc9c-6672-5ab3-d995-4942343ae5b6",
+		"version": 3
+	}`
+	web3Password = "testpassword"
+	web3Secret   = "7a28b5ba57c53603b0b07b56bba752f7784bf506fa95edc395f5cf6c7514fe9d"
+)
+
+// Test vectors from EIP-2335.
+const (
+	eip2335ScryptVector = `{
+		"crypto": {
+			"kdf": {
+				"function": "scrypt",
+				"params": {
+					"dklen": 32,
+					"n": 262144,
+					"p": 1,
+					"r": 8,
+					"salt": "d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+				},
+				"message": ""
+			},
+			"checksum": {
+				"function": "sha256",
+				"params": {},
+				"message": "d2217fe5f3e9a1e34581ef8a78f7c9928e436d36dacc5e846690a5581e8ea484"
+			},
+			"cipher": {
+				"function": "aes-128-ctr",
+				"params": {"iv": "264daa3f303d7259501c93d997d84fe6"},
+				"message": "06ae90d55fe0a6e9c5c3bc5b170827b2e5cce3929ed3f116c2811e6366dfe20f"
+			}
+		},
+		"description": "This is a test keystore that uses scrypt to secure the secret.",
+		"pubkey": "9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07",
+		"path": "m/12381/60/3141592653/589793238",
+		"uuid": "1d85ae20-35c5-4611-98e8-aa14a633906f",
+		"version": 4
+	}`
+	eip2335PBKDF2Vector = `{
+		"crypto": {
+			"kdf": {
+				"function": "pbkdf2",
+				"params": {
+					"dklen": 32,
+					"c": 262144,
+					"prf": "hmac-sha256",
+					"salt": "d4e56740f876aef8c010b86a40d5f56745a118d0906a34e69aec8c0db1cb8fa3"
+				},
+				"message": ""
+			},
+			"checksum": {
+				"function": "sha256",
+				"params": {},
+				"message": "8a9f5d9912ed7e75ea794bc5a89bca5f193721d30868ade6f73043c6ea6febf1"
+			},
+			"cipher": {
+				"function": "aes-128-ctr",
+				"params": {"iv": "264daa3f303d7259501c93d997d84fe6"},
+				"message": "cee03fde2af33149775b7223e7845e4fb2c8ae1792e5f99fe9ecf474cc8c16ad"
+			}
+		},
+		"description": "This is a test keystore that uses PBKDF2 to secure the secret.",
+		"pubkey": "9612d7a727c9d0a22e185a1c768478dfe919cada9266988cb32359c11f2b7b27f4ae4040902382ae2910c15e2b420d07",
+		"path": "m/12381/60/0/0",
+		"uuid": "64625def-3331-4eea-ab6f-782f3ed16a83",
+		"version": 4
+	}`
+	// NFKD turns the password into "testpassword🔑".
+	eip2335TestPassword = "𝔱𝔢𝔰𝔱𝔭𝔞𝔰𝔰𝔴𝔬𝔯𝔡🔑"
+	eip2335Secret       = "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"
+)
+
+func TestLoadWeb3Vectors(t *testing.T) {
+	for name, vector := range map[string]string{"scrypt": web3ScryptVector, "pbkdf2": web3PBKDF2Vector} {
+		key, err := loadKeystore([]byte(vector), web3Password)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got := hex.EncodeToString(ed25519.PrivateKey(key).Seed()); got != web3Secret {
+			t.Errorf("%s: secret = %s, want %s", name, got, web3Secret)
+		}
+		if _, err := loadKeystore([]byte(vector), "wrong"); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: wrong password: got %v, want ErrDecrypt", name, err)
+		}
+	}
+}
+
+func TestLoadEIP2335Vectors(t *testing.T) {
+	passwords := []string{
+		eip2335TestPassword,
+		"testpassword🔑",
+		// C0, Delete and C1 control codes are stripped.
+		"test\x00\x01pass\tword\x7f\u0080\u009f🔑",
+	}
+	for name, vector := range map[string]string{"scrypt": eip2335ScryptVector, "pbkdf2": eip2335PBKDF2Vector} {
+		for _, password := range passwords {
+			key, err := loadKeystore([]byte(vector), password)
+			if err != nil {
+				t.Errorf("%s %q: %v", name, password, err)
+				continue
+			}
+			if got := hex.EncodeToString(ed25519.PrivateKey(key).Seed()); got != eip2335Secret {
+				t.Errorf("%s %q: secret = %s, want %s", name, password, got, eip2335Secret)
+			}
+		}
+		if _, err := loadKeystore([]byte(vector), "testpassword"); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: wrong password: got %v, want ErrDecrypt", name, err)
+		}
+	}
+}
+
+func TestEIP2335RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	light := &Options{Format: FormatEIP2335, ScryptN: LightScryptN, ScryptP: LightScryptP, Label: "validator"}
+
+	// A new file takes its description from the label and its pubkey from
+	// the key.
+	path := filepath.Join(dir, "new.json")
+	if err := SaveAsKeystoreWithOptions(testKey, path, eip2335TestPassword, light); err != nil {
+		t.Fatal(err)
+	}
+	ks := readEIP2335(t, path)
+	if ks.Version != 4 || ks.Description != "validator" || ks.UUID == "" {
+		t.Errorf("unexpected fields: %+v", ks)
+	}
+	if want := hex.EncodeToString(ed25519.PrivateKey(testKey).Public().(ed25519.PublicKey)); ks.PubKey != want {
+		t.Errorf("pubkey = %s, want %s", ks.PubKey, want)
+	}
+	key, err := LoadPrivKeyFromKeystore(path, "testpassword🔑")
+	if err != nil || !bytes.Equal(key, testKey) {
+		t.Fatalf("load failed: %v", err)
+	}
+
+	// Re-encrypting an existing file keeps description, path, pubkey and
+	// uuid as they are.
+	path = filepath.Join(dir, "vector.json")
+	if err := os.WriteFile(path, []byte(eip2335ScryptVector), 0600); err != nil {
+		t.Fatal(err)
+	}
+	before := readEIP2335(t, path)
+	if err := ChangePassword(path, eip2335TestPassword, "new password", light); err != nil {
+		t.Fatal(err)
+	}
+	after := readEIP2335(t, path)
+	if after.Description != before.Description || after.Path != before.Path ||
+		after.PubKey != before.PubKey || after.UUID != before.UUID || after.Version != 4 {
+		t.Errorf("fields changed: %+v, want %+v", after, before)
+	}
+	key, err = LoadPrivKeyFromKeystore(path, "new password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(ed25519.PrivateKey(key).Seed()); got != eip2335Secret {
+		t.Errorf("secret = %s, want %s", got, eip2335Secret)
+	}
+}
+
+func readEIP2335(t *testing.T, path string) eip2335Keystore {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ks eip2335Keystore
+	if err := json.Unmarshal(data, &ks); err != nil {
+		t.Fatal(err)
+	}
+	return ks
+}
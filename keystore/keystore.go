@@ -1,68 +1,151 @@
 package keystore
 
 import (
-	"encoding/json"
 	"errors"
-	"io/fs"
 	"os"
 )
 
 var (
 	ErrDecrypt   = errors.New("could not decrypt key with given password")
 	ErrNotUnlock = errors.New("the key store not unlock")
+	ErrKDFLimits = errors.New("keystore KDF parameters exceed limits")
 )
 
-type Keystore struct {
-	Crypto cryptoJson `json:"crtpto"`
+// Options configures how new keystore files are encrypted. The zero value
+// selects Argon2id with the standard parameters.
+type Options struct {
+	// Format selects the file layout; the default is FormatNative. The Web3
+	// v3 and EIP-2335 formats only support scrypt and aes-128-ctr.
+	Format Format
+
+	// KDF is KDFArgon2id (the default when empty) or KDFScrypt. PBKDF2 files
+	// can be read but not written.
+	KDF string
+
+	// Cipher is CipherAES256GCM (the default when empty),
+	// CipherXChaCha20Poly1305 or CipherAES128CTR. The AEAD ciphers also
+	// authenticate the KDF parameters and metadata, so tampering with them is
+	// detected; aes-128-ctr only exists for compatibility with older files.
+	// The Web3 v3 and EIP-2335 formats always use aes-128-ctr.
+	Cipher string
+
+	// Label is stored in clear text in new files to help identify them.
+	Label string
+
+	// Argon2id parameters; zero values take the standard ones.
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+
+	// scrypt parameters; zero values take the standard ones.
+	ScryptN int
+	ScryptP int
 }
 
-// 持久化keystore文件
-func SaveAsKeystore(key []byte, filepath, password string, useLightweightKDF bool) error {
-	scryptN := StandardScryptN
-	scryptP := StandardScryptP
+// LightOptions returns options with the light Argon2id parameters, which
+// are fast enough for tests and constrained devices.
+func LightOptions() *Options {
+	return &Options{
+		KDF:               KDFArgon2id,
+		Argon2Memory:      LightArgon2Memory,
+		Argon2Iterations:  LightArgon2Iterations,
+		Argon2Parallelism: LightArgon2Parallelism,
+	}
+}
 
-	if useLightweightKDF {
-		scryptN = LightScryptN
-		scryptP = LightScryptP
+func (o *Options) kdf() string {
+	if o == nil || o.KDF == "" {
+		return KDFArgon2id
 	}
+	return o.KDF
+}
 
-	var ks = new(Keystore)
+func (o *Options) format() Format {
+	if o == nil {
+		return FormatNative
+	}
+	return o.Format
+}
 
-	cryptoJson, err := encryptData(key, []byte(password), scryptN, scryptP)
-	if err != nil {
-		return err
+func (o *Options) cipher() string {
+	if o == nil || o.Cipher == "" {
+		return CipherAES256GCM
 	}
+	return o.Cipher
+}
 
-	ks.Crypto = cryptoJson
+func (o *Options) argon2Params() (memory, iterations uint32, parallelism uint8) {
+	memory, iterations, parallelism = StandardArgon2Memory, StandardArgon2Iterations, StandardArgon2Parallelism
+	if o == nil {
+		return
+	}
+	if o.Argon2Memory != 0 {
+		memory = o.Argon2Memory
+	}
+	if o.Argon2Iterations != 0 {
+		iterations = o.Argon2Iterations
+	}
+	if o.Argon2Parallelism != 0 {
+		parallelism = o.Argon2Parallelism
+	}
+	return
+}
 
-	var js []byte
-	if js, err = json.Marshal(ks); err != nil {
-		return err
+func (o *Options) scryptParams() (n, p int) {
+	n, p = StandardScryptN, StandardScryptP
+	if o == nil {
+		return
+	}
+	if o.ScryptN != 0 {
+		n = o.ScryptN
+	}
+	if o.ScryptP != 0 {
+		p = o.ScryptP
+	}
+	return
+}
+
+// 持久化keystore文件，使用Argon2id加密
+func SaveAsKeystore(key []byte, filepath, password string, useLightweightKDF bool) error {
+	var opts *Options
+	if useLightweightKDF {
+		opts = LightOptions()
 	}
 
-	if err = os.WriteFile(filepath, js, fs.ModeAppend); err != nil {
+	return SaveAsKeystoreWithOptions(key, filepath, password, opts)
+}
+
+// 按指定的加密参数和格式持久化keystore文件
+func SaveAsKeystoreWithOptions(key []byte, filepath, password string, opts *Options) error {
+	js, err := marshalKeystore(key, password, opts)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return writeFileAtomic(filepath, js)
 }
 
-// 从keystore文件加载私钥
+// 从keystore文件加载私钥，自动识别本包格式(含旧版"crtpto")、Web3 v3和EIP-2335
 func LoadPrivKeyFromKeystore(filepath, password string) ([]byte, error) {
 	data, err := os.ReadFile(filepath)
 	if err != nil {
 		return nil, err
 	}
 
-	var ks = new(Keystore)
-	if err := json.Unmarshal(data, ks); err != nil {
-		return nil, err
+	return loadKeystore(data, password)
+}
+
+// 以原子方式修改keystore文件的密码，元数据和文件权限不变，opts为nil时沿用原有KDF和加密算法，但本包格式的aes-128-ctr升级为aes-256-gcm
+func ChangePassword(filepath, oldPassword, newPassword string, opts *Options) error {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return err
 	}
 
-	k, err := decryptData(ks.Crypto, password)
+	js, err := reencryptKeystore(data, oldPassword, newPassword, opts)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	return k, nil
+	return writeFileAtomic(filepath, js)
 }
@@ -0,0 +1,215 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var lightScrypt = &Options{KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP}
+
+func TestChangePasswordWrongPassword(t *testing.T) {
+	dir := t.TempDir()
+	for i, opts := range []*Options{
+		lightScrypt,
+		{Format: FormatWeb3V3, ScryptN: LightScryptN, ScryptP: LightScryptP},
+		{Format: FormatEIP2335, ScryptN: LightScryptN, ScryptP: LightScryptP},
+	} {
+		path := filepath.Join(dir, "key.json")
+		if err := SaveAsKeystoreWithOptions(testKey, path, "password", opts); err != nil {
+			t.Fatal(err)
+		}
+		before, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ChangePassword(path, "wrong", "new", nil); err == nil {
+			t.Errorf("%d: ChangePassword accepted a wrong password", i)
+		}
+		after, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(before, after) {
+			t.Errorf("%d: file changed after a failed ChangePassword", i)
+		}
+	}
+}
+
+func TestChangePasswordKeepsMetadata(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	opts := *lightScrypt
+	opts.Label = "main"
+	if err := SaveAsKeystoreWithOptions(testKey, path, "password", &opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatal(err)
+	}
+	before, err := ReadKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ChangePassword(path, "password", "new", nil); err != nil {
+		t.Fatal(err)
+	}
+	after, err := ReadKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Version != before.Version || after.ID != before.ID || !after.CreatedAt.Equal(before.CreatedAt) ||
+		after.Label != before.Label || after.PublicKey != before.PublicKey {
+		t.Errorf("metadata changed: %+v, want %+v", after, before)
+	}
+	if after.Crypto.KDF != KDFScrypt || after.Crypto.Cipher != CipherAES256GCM {
+		t.Errorf("got %s/%s, want the original %s/%s", after.Crypto.KDF, after.Crypto.Cipher, KDFScrypt, CipherAES256GCM)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0640 {
+		t.Errorf("mode = %v (%v), want 0640", fi.Mode().Perm(), err)
+	}
+
+	key, err := LoadPrivKeyFromKeystore(path, "new")
+	if err != nil || !bytes.Equal(key, testKey) {
+		t.Fatalf("load with the new password: %v", err)
+	}
+	if _, err := LoadPrivKeyFromKeystore(path, "password"); err == nil {
+		t.Error("old password still works")
+	}
+}
+
+func TestChangePasswordUpgradesCTR(t *testing.T) {
+	dir := t.TempDir()
+	ctrOpts := *lightScrypt
+	ctrOpts.Cipher = CipherAES128CTR
+
+	// A legacy "crtpto" file and a current one, both using aes-128-ctr.
+	c, err := encryptData(testKey, []byte("password"), &ctrOpts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := json.Marshal(map[string]interface{}{"crtpto": c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyPath := filepath.Join(dir, "legacy.json")
+	if err := os.WriteFile(legacyPath, legacy, 0600); err != nil {
+		t.Fatal(err)
+	}
+	currentPath := filepath.Join(dir, "current.json")
+	if err := SaveAsKeystoreWithOptions(testKey, currentPath, "password", &ctrOpts); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{legacyPath, currentPath} {
+		if err := ChangePassword(path, "password", "new", nil); err != nil {
+			t.Fatal(err)
+		}
+		ks, err := ReadKeystore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ks.Version != Version || ks.Crypto.KDF != KDFScrypt || ks.Crypto.Cipher != CipherAES256GCM {
+			t.Errorf("%s: got version %d %s/%s, want version %d %s/%s", filepath.Base(path),
+				ks.Version, ks.Crypto.KDF, ks.Crypto.Cipher, Version, KDFScrypt, CipherAES256GCM)
+		}
+		key, err := ks.Decrypt("new")
+		if err != nil || !bytes.Equal(key, testKey) {
+			t.Errorf("%s: Decrypt: %v", filepath.Base(path), err)
+		}
+	}
+}
+
+func TestChangePasswordOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	ctrOpts := *lightScrypt
+	ctrOpts.Cipher = CipherAES128CTR
+	ctrOpts.Label = "main"
+	if err := SaveAsKeystoreWithOptions(testKey, path, "password", &ctrOpts); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := LightOptions()
+	opts.Cipher = CipherXChaCha20Poly1305
+	opts.Format = FormatWeb3V3 // ignored: the format never changes
+	opts.Label = "ignored"
+	if err := ChangePassword(path, "password", "new", opts); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := ReadKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.Version != Version || ks.Label != "main" {
+		t.Errorf("version %d label %q, want %d %q", ks.Version, ks.Label, Version, "main")
+	}
+	if ks.Crypto.KDF != KDFArgon2id || ks.Crypto.Cipher != CipherXChaCha20Poly1305 {
+		t.Errorf("got %s/%s, want %s/%s", ks.Crypto.KDF, ks.Crypto.Cipher, KDFArgon2id, CipherXChaCha20Poly1305)
+	}
+	key, err := ks.Decrypt("new")
+	if err != nil || !bytes.Equal(key, testKey) {
+		t.Errorf("Decrypt: %v", err)
+	}
+}
+
+func TestChangePasswordKeepsFormat(t *testing.T) {
+	dir := t.TempDir()
+	for _, format := range []Format{FormatWeb3V3, FormatEIP2335} {
+		path := filepath.Join(dir, "key.json")
+		opts := &Options{Format: format, ScryptN: LightScryptN, ScryptP: LightScryptP}
+		if err := SaveAsKeystoreWithOptions(testKey, path, "password", opts); err != nil {
+			t.Fatal(err)
+		}
+
+		for _, newOpts := range []*Options{nil, {KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP - 1}} {
+			if err := ChangePassword(path, "password", "new", newOpts); err != nil {
+				t.Fatalf("%d: %v", format, err)
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, err := detectFormat(data); err != nil || got != format {
+				t.Errorf("format = %d (%v), want %d", got, err, format)
+			}
+			if !bytes.Contains(data, []byte(`"`+CipherAES128CTR+`"`)) {
+				t.Errorf("%d: cipher changed: %s", format, data)
+			}
+			key, err := loadKeystore(data, "new")
+			if err != nil || !bytes.Equal(key, testKey) {
+				t.Errorf("%d: load: %v", format, err)
+			}
+			// Swap back for the next round.
+			if err := ChangePassword(path, "new", "password", newOpts); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestChangePasswordEIP2335RejectsArgon2id(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	opts := &Options{Format: FormatEIP2335, ScryptN: LightScryptN, ScryptP: LightScryptP}
+	if err := SaveAsKeystoreWithOptions(testKey, path, "password", opts); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = ChangePassword(path, "password", "new", LightOptions())
+	if err == nil || !strings.Contains(err.Error(), "unsupported KDF for this keystore format") {
+		t.Fatalf("got %v, want the unsupported KDF error", err)
+	}
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("file changed after a failed ChangePassword")
+	}
+}
@@ -26,23 +26,32 @@ The crypto is documented at https://github.com/ethereum/wiki/wiki/Web3-Secret-St
 package keystore
 
 import (
-	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"math"
 
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
 	"golang.org/x/crypto/pbkdf2"
 	"golang.org/x/crypto/scrypt"
 )
 
-// Constants for Scrypt and AES
+// Constants for the KDFs and ciphers
 const (
-	keyHeaderKDF = "scrypt"
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+	KDFPBKDF2   = "pbkdf2"
+
+	CipherAES128CTR         = "aes-128-ctr"
+	CipherAES256GCM         = "aes-256-gcm"
+	CipherXChaCha20Poly1305 = "xchacha20-poly1305"
 
 	StandardScryptN = 1 << 18
 	StandardScryptP = 1
@@ -50,6 +59,16 @@ const (
 	LightScryptN = 1 << 12
 	LightScryptP = 6
 
+	// Argon2id memory is in KiB. The standard parameters follow the second
+	// recommended option of RFC 9106.
+	StandardArgon2Memory      = 64 * 1024
+	StandardArgon2Iterations  = 3
+	StandardArgon2Parallelism = 4
+
+	LightArgon2Memory      = 8 * 1024
+	LightArgon2Iterations  = 1
+	LightArgon2Parallelism = 4
+
 	scryptR     = 8
 	scryptDKLen = 32
 )
@@ -61,16 +80,18 @@ type cryptoJson struct {
 	CipherParams cipherparamsJSON       `json:"cipherparams"`
 	KDF          string                 `json:"kdf"`
 	KDFParams    map[string]interface{} `json:"kdfparams"`
-	MAC          string                 `json:"mac"`
+	MAC          string                 `json:"mac,omitempty"`
 }
 
-// CipherParamsJSON holds the IV parameter
+// CipherParamsJSON holds the IV of aes-128-ctr or the nonce of an AEAD cipher
 type cipherparamsJSON struct {
-	IV string `json:"iv"`
+	IV    string `json:"iv,omitempty"`
+	Nonce string `json:"nonce,omitempty"`
 }
 
-// encryptData encrypts the given data with the specified password and scrypt parameters
-func encryptData(data, password []byte, scryptN, scryptP int) (cryptoJson, error) {
+// encryptData encrypts the given data with the specified password and options.
+// AEAD ciphers also authenticate the KDF, its parameters and meta.
+func encryptData(data, password []byte, opts *Options, meta []byte) (cryptoJson, error) {
 	// 生成加密盐
 	salt := make([]byte, 32)
 	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
@@ -78,55 +99,149 @@ func encryptData(data, password []byte, scryptN, scryptP int) (cryptoJson, error
 	}
 
 	// 生成加密的密钥
-	derivedKey, err := scrypt.Key(password, salt, scryptN, scryptR, scryptP, scryptDKLen)
+	kdf, kdfParams, derivedKey, err := deriveKey(password, salt, opts)
 	if err != nil {
 		return cryptoJson{}, err
 	}
-	encryptKey := derivedKey[:16]
 
-	// 生成私钥密文
-	iv := make([]byte, aes.BlockSize)
-	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
-		return cryptoJson{}, fmt.Errorf("reading from crypto/rand failed: %w", err)
+	cryptoStruct := cryptoJson{
+		Cipher:    opts.cipher(),
+		KDF:       kdf,
+		KDFParams: kdfParams,
 	}
-	cipherText, err := aesCTRXOR(encryptKey, data, iv)
-	if err != nil {
-		return cryptoJson{}, err
+
+	switch cryptoStruct.Cipher {
+	case CipherAES128CTR:
+		encryptKey := derivedKey[:16]
+
+		// 生成私钥密文
+		iv := make([]byte, aes.BlockSize)
+		if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+			return cryptoJson{}, fmt.Errorf("reading from crypto/rand failed: %w", err)
+		}
+		cipherText, err := aesCTRXOR(encryptKey, data, iv)
+		if err != nil {
+			return cryptoJson{}, err
+		}
+
+		// 生成用于验证密码的代码
+		// mac := crypto.Keccak256(derivedKey[16:32], cipherText)
+		h := hmac.New(sha256.New, derivedKey[16:32])
+		h.Write(cipherText)
+		mac := h.Sum(nil)
+
+		cryptoStruct.CipherText = hex.EncodeToString(cipherText)
+		cryptoStruct.CipherParams.IV = hex.EncodeToString(iv)
+		cryptoStruct.MAC = hex.EncodeToString(mac)
+	case CipherAES256GCM, CipherXChaCha20Poly1305:
+		aead, err := newAEAD(cryptoStruct.Cipher, derivedKey)
+		if err != nil {
+			return cryptoJson{}, err
+		}
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return cryptoJson{}, fmt.Errorf("reading from crypto/rand failed: %w", err)
+		}
+		ad, err := additionalData(cryptoStruct, meta)
+		if err != nil {
+			return cryptoJson{}, err
+		}
+
+		cryptoStruct.CipherText = hex.EncodeToString(aead.Seal(nil, nonce, data, ad))
+		cryptoStruct.CipherParams.Nonce = hex.EncodeToString(nonce)
+	default:
+		return cryptoJson{}, fmt.Errorf("cipher not supported: %v", cryptoStruct.Cipher)
 	}
 
-	// 生成用于验证密码的代码
-	// mac := crypto.Keccak256(derivedKey[16:32], cipherText)
-	h := hmac.New(sha256.New, derivedKey[16:32])
-	h.Write(cipherText)
-	mac := h.Sum(nil)
+	return cryptoStruct, nil
+}
 
-	scryptParamsJSON := map[string]interface{}{
-		"n":     scryptN,
-		"r":     scryptR,
-		"p":     scryptP,
-		"dklen": scryptDKLen,
-		"salt":  hex.EncodeToString(salt),
+// newAEAD returns the AEAD cipher keyed with the 32-byte derived key
+func newAEAD(name string, derivedKey []byte) (cipher.AEAD, error) {
+	if len(derivedKey) < 32 {
+		return nil, fmt.Errorf("derived key too short for %s", name)
 	}
-	cipherParamsJSON := cipherparamsJSON{
-		IV: hex.EncodeToString(iv),
+
+	switch name {
+	case CipherAES256GCM:
+		block, err := aes.NewCipher(derivedKey[:32])
+		if err != nil {
+			return nil, err
+		}
+		return cipher.NewGCM(block)
+	case CipherXChaCha20Poly1305:
+		return chacha20poly1305.NewX(derivedKey[:32])
+	default:
+		return nil, fmt.Errorf("cipher not supported: %v", name)
 	}
+}
 
-	cryptoStruct := cryptoJson{
-		Cipher:       "aes-128-ctr",
-		CipherText:   hex.EncodeToString(cipherText),
-		CipherParams: cipherParamsJSON,
-		KDF:          keyHeaderKDF,
-		KDFParams:    scryptParamsJSON,
-		MAC:          hex.EncodeToString(mac),
+// additionalData binds the cipher, the KDF with its parameters and the
+// file's metadata to the AEAD ciphertext, so that editing any of them makes
+// decryption fail. kdfparams is re-encoded, which sorts its keys and yields
+// the same bytes whether numbers were written as ints or read as floats.
+func additionalData(c cryptoJson, meta []byte) ([]byte, error) {
+	return json.Marshal(struct {
+		Cipher    string                 `json:"cipher"`
+		KDF       string                 `json:"kdf"`
+		KDFParams map[string]interface{} `json:"kdfparams"`
+		Meta      json.RawMessage        `json:"meta,omitempty"`
+	}{c.Cipher, c.KDF, c.KDFParams, meta})
+}
+
+// deriveKey runs the KDF selected by opts and returns its name and the
+// kdfparams to store alongside the derived key.
+func deriveKey(password, salt []byte, opts *Options) (string, map[string]interface{}, []byte, error) {
+	switch opts.kdf() {
+	case KDFArgon2id:
+		m, t, p := opts.argon2Params()
+		if err := checkArgon2Params(int(m), int(t), int(p)); err != nil {
+			return "", nil, nil, err
+		}
+		derivedKey := argon2.IDKey(password, salt, t, m, p, scryptDKLen)
+		return KDFArgon2id, map[string]interface{}{
+			"memory":      m,
+			"iterations":  t,
+			"parallelism": p,
+			"dklen":       scryptDKLen,
+			"salt":        hex.EncodeToString(salt),
+		}, derivedKey, nil
+	case KDFScrypt:
+		n, p := opts.scryptParams()
+		if err := checkScryptParams(n, scryptR, p); err != nil {
+			return "", nil, nil, err
+		}
+		derivedKey, err := scrypt.Key(password, salt, n, scryptR, p, scryptDKLen)
+		if err != nil {
+			return "", nil, nil, err
+		}
+		return KDFScrypt, map[string]interface{}{
+			"n":     n,
+			"r":     scryptR,
+			"p":     p,
+			"dklen": scryptDKLen,
+			"salt":  hex.EncodeToString(salt),
+		}, derivedKey, nil
+	default:
+		return "", nil, nil, fmt.Errorf("unsupported KDF for new keystores: %s", opts.KDF)
 	}
-	return cryptoStruct, nil
 }
 
-// decryptData decrypts the given encrypted data with the specified password
-func decryptData(cryptoJson cryptoJson, auth string) ([]byte, error) {
-	if cryptoJson.Cipher != "aes-128-ctr" {
+// decryptData decrypts the given encrypted data with the specified password.
+// meta must be the metadata that was passed to encryptData.
+func decryptData(cryptoJson cryptoJson, auth string, meta []byte) ([]byte, error) {
+	switch cryptoJson.Cipher {
+	case CipherAES128CTR:
+		return decryptCTR(cryptoJson, auth)
+	case CipherAES256GCM, CipherXChaCha20Poly1305:
+		return decryptAEAD(cryptoJson, auth, meta)
+	default:
 		return nil, fmt.Errorf("cipher not supported: %v", cryptoJson.Cipher)
 	}
+}
+
+func decryptCTR(cryptoJson cryptoJson, auth string) ([]byte, error) {
 	mac, err := hex.DecodeString(cryptoJson.MAC)
 	if err != nil {
 		return nil, err
@@ -151,7 +266,7 @@ func decryptData(cryptoJson cryptoJson, auth string) ([]byte, error) {
 	h := hmac.New(sha256.New, derivedKey[16:32])
 	h.Write(cipherText)
 	calculatedMAC := h.Sum(nil)
-	if !bytes.Equal(calculatedMAC, mac) {
+	if !hmac.Equal(calculatedMAC, mac) {
 		return nil, fmt.Errorf("invalid MAC, decryption failed")
 	}
 
@@ -162,6 +277,43 @@ func decryptData(cryptoJson cryptoJson, auth string) ([]byte, error) {
 	return plainText, nil
 }
 
+func decryptAEAD(cryptoJson cryptoJson, auth string, meta []byte) ([]byte, error) {
+	nonce, err := hex.DecodeString(cryptoJson.CipherParams.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	cipherText, err := hex.DecodeString(cryptoJson.CipherText)
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := getKDFKey(cryptoJson, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newAEAD(cryptoJson.Cipher, derivedKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce length for %s", cryptoJson.Cipher)
+	}
+
+	ad, err := additionalData(cryptoJson, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// 密码错误或kdfparams、元数据被篡改都会导致认证失败
+	plainText, err := aead.Open(nil, nonce, cipherText, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plainText, nil
+}
+
 // aesCTRXOR performs AES-128-CTR encryption/decryption
 func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
 	aesBlock, err := aes.NewCipher(key)
@@ -174,24 +326,78 @@ func aesCTRXOR(key, inText, iv []byte) ([]byte, error) {
 	return outText, nil
 }
 
+// Upper bounds on the KDF parameters accepted from a keystore file, so that
+// a crafted file cannot exhaust memory or CPU. They leave ample room above
+// the standard parameters; deriveKey enforces them too.
+const (
+	maxArgon2Memory     = 1 << 21 // KiB, i.e. 2 GiB
+	maxArgon2Iterations = 64
+	maxScryptN          = 1 << 20
+	maxScryptR          = 32
+	maxScryptP          = 16
+	maxScryptMemory     = 1 << 30 // 128 * N * r bytes
+	maxPBKDF2Iterations = 10000000
+
+	minDKLen = 32
+	maxDKLen = 64
+)
+
 // getKDFKey generates the derived key using the specified KDF parameters and password
 func getKDFKey(cryptoJSON cryptoJson, auth string) ([]byte, error) {
 	authArray := []byte(auth)
-	salt, err := hex.DecodeString(cryptoJSON.KDFParams["salt"].(string))
+	saltHex, err := kdfString(cryptoJSON.KDFParams, "salt")
 	if err != nil {
 		return nil, err
 	}
-	dkLen := ensureInt(cryptoJSON.KDFParams["dklen"])
+	salt, err := hex.DecodeString(saltHex)
+	if err != nil {
+		return nil, err
+	}
+	dkLen, err := kdfInt(cryptoJSON.KDFParams, "dklen")
+	if err != nil {
+		return nil, err
+	}
+	// decryptCTR and newAEAD use the first 32 bytes of the derived key
+	if dkLen < minDKLen || dkLen > maxDKLen {
+		return nil, fmt.Errorf("invalid KDF dklen: %d", dkLen)
+	}
 
 	switch cryptoJSON.KDF {
-	case keyHeaderKDF:
-		n := ensureInt(cryptoJSON.KDFParams["n"])
-		r := ensureInt(cryptoJSON.KDFParams["r"])
-		p := ensureInt(cryptoJSON.KDFParams["p"])
+	case KDFArgon2id:
+		v, err := kdfInts(cryptoJSON.KDFParams, "memory", "iterations", "parallelism")
+		if err != nil {
+			return nil, err
+		}
+		m, t, p := v[0], v[1], v[2]
+		if err := checkArgon2Params(m, t, p); err != nil {
+			return nil, err
+		}
+		return argon2.IDKey(authArray, salt, uint32(t), uint32(m), uint8(p), uint32(dkLen)), nil
+	case KDFScrypt:
+		v, err := kdfInts(cryptoJSON.KDFParams, "n", "r", "p")
+		if err != nil {
+			return nil, err
+		}
+		n, r, p := v[0], v[1], v[2]
+		if err := checkScryptParams(n, r, p); err != nil {
+			return nil, err
+		}
 		return scrypt.Key(authArray, salt, n, r, p, dkLen)
-	case "pbkdf2":
-		c := ensureInt(cryptoJSON.KDFParams["c"])
-		prf := cryptoJSON.KDFParams["prf"].(string)
+	case KDFPBKDF2:
+		c, err := kdfInt(cryptoJSON.KDFParams, "c")
+		if err != nil {
+			return nil, err
+		}
+		if c <= 0 {
+			return nil, fmt.Errorf("invalid PBKDF2 iteration count: %d", c)
+		}
+		if c > maxPBKDF2Iterations {
+			return nil, fmt.Errorf("%w: pbkdf2 c=%d", ErrKDFLimits, c)
+		}
+		prf, err := kdfString(cryptoJSON.KDFParams, "prf")
+		if err != nil {
+			return nil, err
+		}
 		if prf != "hmac-sha256" {
 			return nil, fmt.Errorf("unsupported PBKDF2 PRF: %s", prf)
 		}
@@ -201,11 +407,76 @@ func getKDFKey(cryptoJSON cryptoJson, auth string) ([]byte, error) {
 	}
 }
 
-// ensureInt ensures that the provided interface is converted to an integer
-func ensureInt(x interface{}) int {
-	res, ok := x.(int)
+func checkArgon2Params(memory, iterations, parallelism int) error {
+	if memory <= 0 || iterations <= 0 || parallelism <= 0 || parallelism > 255 {
+		return fmt.Errorf("invalid argon2id parameters")
+	}
+	if memory > maxArgon2Memory || iterations > maxArgon2Iterations {
+		return fmt.Errorf("%w: argon2id memory=%d iterations=%d", ErrKDFLimits, memory, iterations)
+	}
+	return nil
+}
+
+func checkScryptParams(n, r, p int) error {
+	if n <= 1 || n&(n-1) != 0 || r <= 0 || p <= 0 {
+		return fmt.Errorf("invalid scrypt parameters")
+	}
+	if n > maxScryptN || r > maxScryptR || p > maxScryptP || 128*n*r > maxScryptMemory {
+		return fmt.Errorf("%w: scrypt n=%d r=%d p=%d", ErrKDFLimits, n, r, p)
+	}
+	return nil
+}
+
+// kdfString returns the string parameter name of kdfparams
+func kdfString(params map[string]interface{}, name string) (string, error) {
+	s, ok := params[name].(string)
 	if !ok {
-		res = int(x.(float64))
+		return "", fmt.Errorf("invalid or missing kdfparams %q", name)
+	}
+	return s, nil
+}
+
+// kdfInt returns the integer parameter name of kdfparams
+func kdfInt(params map[string]interface{}, name string) (int, error) {
+	v, err := ensureInt(params[name])
+	if err != nil {
+		return 0, fmt.Errorf("invalid or missing kdfparams %q: %w", name, err)
+	}
+	return v, nil
+}
+
+// kdfInts returns the integer parameters names of kdfparams, in order
+func kdfInts(params map[string]interface{}, names ...string) ([]int, error) {
+	vals := make([]int, len(names))
+	for i, name := range names {
+		v, err := kdfInt(params, name)
+		if err != nil {
+			return nil, err
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// ensureInt converts a JSON number, decoded as float64, or an int to an
+// int. Fractional, negative and out-of-range values are rejected.
+func ensureInt(x interface{}) (int, error) {
+	switch v := x.(type) {
+	case int:
+		if v < 0 {
+			return 0, fmt.Errorf("negative value %d", v)
+		}
+		return v, nil
+	case uint32:
+		return int(v), nil
+	case uint8:
+		return int(v), nil
+	case float64:
+		if v < 0 || v > math.MaxInt32 || v != math.Trunc(v) {
+			return 0, fmt.Errorf("not a valid integer: %v", v)
+		}
+		return int(v), nil
+	default:
+		return 0, fmt.Errorf("not a number: %T", x)
 	}
-	return res
 }
@@ -0,0 +1,210 @@
+package keystore
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var testKey = []byte(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{0x42}, ed25519.SeedSize)))
+
+func TestEnsureInt(t *testing.T) {
+	tests := []struct {
+		in   interface{}
+		want int
+		ok   bool
+	}{
+		{262144, 262144, true},
+		{float64(8), 8, true},
+		{uint32(65536), 65536, true},
+		{uint8(4), 4, true},
+		{float64(1.5), 0, false},
+		{float64(-1), 0, false},
+		{-1, 0, false},
+		{float64(1 << 40), 0, false},
+		{"8", 0, false},
+		{nil, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ensureInt(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ensureInt(%#v) = %d, %v", tt.in, got, err)
+		}
+	}
+}
+
+func TestGetKDFKeyRejectsBadParams(t *testing.T) {
+	salt := "0102030405060708"
+	tests := []struct {
+		name   string
+		kdf    string
+		params map[string]interface{}
+		limits bool
+	}{
+		{"missing salt", KDFScrypt, map[string]interface{}{"n": 1024.0, "r": 8.0, "p": 1.0, "dklen": 32.0}, false},
+		{"numeric salt", KDFScrypt, map[string]interface{}{"salt": 1.0, "n": 1024.0, "r": 8.0, "p": 1.0, "dklen": 32.0}, false},
+		{"short dklen", KDFScrypt, map[string]interface{}{"salt": salt, "n": 1024.0, "r": 8.0, "p": 1.0, "dklen": 16.0}, false},
+		{"missing dklen", KDFScrypt, map[string]interface{}{"salt": salt, "n": 1024.0, "r": 8.0, "p": 1.0}, false},
+		{"string n", KDFScrypt, map[string]interface{}{"salt": salt, "n": "1024", "r": 8.0, "p": 1.0, "dklen": 32.0}, false},
+		{"scrypt n", KDFScrypt, map[string]interface{}{"salt": salt, "n": float64(1 << 22), "r": 8.0, "p": 1.0, "dklen": 32.0}, true},
+		{"scrypt r", KDFScrypt, map[string]interface{}{"salt": salt, "n": 1024.0, "r": 1024.0, "p": 1.0, "dklen": 32.0}, true},
+		{"scrypt p", KDFScrypt, map[string]interface{}{"salt": salt, "n": 1024.0, "r": 8.0, "p": 1000.0, "dklen": 32.0}, true},
+		{"argon2 memory", KDFArgon2id, map[string]interface{}{"salt": salt, "memory": float64(1 << 30), "iterations": 1.0, "parallelism": 1.0, "dklen": 32.0}, true},
+		{"argon2 iterations", KDFArgon2id, map[string]interface{}{"salt": salt, "memory": 1024.0, "iterations": 1e6, "parallelism": 1.0, "dklen": 32.0}, true},
+		{"argon2 parallelism", KDFArgon2id, map[string]interface{}{"salt": salt, "memory": 1024.0, "iterations": 1.0, "parallelism": 256.0, "dklen": 32.0}, false},
+		{"pbkdf2 c", KDFPBKDF2, map[string]interface{}{"salt": salt, "c": float64(1 << 30), "prf": "hmac-sha256", "dklen": 32.0}, true},
+		{"pbkdf2 missing prf", KDFPBKDF2, map[string]interface{}{"salt": salt, "c": 1.0, "dklen": 32.0}, false},
+	}
+	for _, tt := range tests {
+		_, err := getKDFKey(cryptoJson{KDF: tt.kdf, KDFParams: tt.params}, "password")
+		if err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		} else if errors.Is(err, ErrKDFLimits) != tt.limits {
+			t.Errorf("%s: got %v, ErrKDFLimits expected: %v", tt.name, err, tt.limits)
+		}
+	}
+}
+
+func TestSaveRejectsParamsBeyondLimits(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	for _, opts := range []*Options{
+		{KDF: KDFArgon2id, Argon2Memory: maxArgon2Memory + 1},
+		{KDF: KDFScrypt, ScryptN: maxScryptN * 2},
+	} {
+		if err := SaveAsKeystoreWithOptions(testKey, path, "password", opts); !errors.Is(err, ErrKDFLimits) {
+			t.Errorf("%+v: got %v, want ErrKDFLimits", opts, err)
+		}
+	}
+}
+
+func TestLoadRejectsTamperedKDFParams(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key.json")
+	opts := &Options{KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP}
+	if err := SaveAsKeystoreWithOptions(testKey, path, "password", opts); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadPrivKeyFromKeystore(path, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, testKey) {
+		t.Fatal("loaded key does not match")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	v["crypto"].(map[string]interface{})["kdfparams"].(map[string]interface{})["n"] = 1 << 30
+	if data, err = json.Marshal(v); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadPrivKeyFromKeystore(path, "password"); !errors.Is(err, ErrKDFLimits) {
+		t.Fatalf("got %v, want ErrKDFLimits", err)
+	}
+}
+
+func TestOptionsFromCryptoBadParams(t *testing.T) {
+	for _, c := range []cryptoJson{
+		{KDF: KDFArgon2id, KDFParams: map[string]interface{}{"memory": "lots"}},
+		{KDF: KDFScrypt, KDFParams: map[string]interface{}{"n": 1024.0}},
+		{KDF: KDFScrypt, KDFParams: map[string]interface{}{"n": float64(1 << 30), "p": 1.0}},
+	} {
+		if _, err := optionsFromCrypto(c); err == nil {
+			t.Errorf("%+v: accepted", c.KDFParams)
+		}
+	}
+}
+
+func TestAEADRoundTrip(t *testing.T) {
+	for _, cipher := range []string{CipherAES256GCM, CipherXChaCha20Poly1305} {
+		path := filepath.Join(t.TempDir(), "key.json")
+		opts := &Options{KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP, Cipher: cipher, Label: "test"}
+		if err := SaveAsKeystoreWithOptions(testKey, path, "password", opts); err != nil {
+			t.Fatalf("%s: %v", cipher, err)
+		}
+		ks, err := ReadKeystore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ks.Crypto.Cipher != cipher {
+			t.Errorf("%s: cipher = %q", cipher, ks.Crypto.Cipher)
+		}
+		key, err := LoadPrivKeyFromKeystore(path, "password")
+		if err != nil || !bytes.Equal(key, testKey) {
+			t.Errorf("%s: load failed: %v", cipher, err)
+		}
+		if _, err := LoadPrivKeyFromKeystore(path, "wrong"); !errors.Is(err, ErrDecrypt) {
+			t.Errorf("%s: wrong password: got %v, want ErrDecrypt", cipher, err)
+		}
+	}
+}
+
+func TestAEADDetectsTampering(t *testing.T) {
+	otherPub := hex.EncodeToString(ed25519.NewKeyFromSeed(bytes.Repeat([]byte{0x43}, ed25519.SeedSize)).Public().(ed25519.PublicKey))
+	tests := []struct {
+		name   string
+		tamper func(v, kdfParams map[string]interface{})
+	}{
+		{"none", func(v, kdfParams map[string]interface{}) {}},
+		{"kdfparams p", func(v, kdfParams map[string]interface{}) { kdfParams["p"] = LightScryptP - 1 }},
+		// scrypt output with a longer dklen has the same prefix, so only the
+		// associated data catches this.
+		{"kdfparams dklen", func(v, kdfParams map[string]interface{}) { kdfParams["dklen"] = maxDKLen }},
+		{"kdfparams extra", func(v, kdfParams map[string]interface{}) { kdfParams["extra"] = 1 }},
+		{"label", func(v, kdfParams map[string]interface{}) { v["label"] = "other" }},
+		{"label removed", func(v, kdfParams map[string]interface{}) { delete(v, "label") }},
+		{"id", func(v, kdfParams map[string]interface{}) { v["id"] = "00000000-0000-4000-8000-000000000000" }},
+		{"created", func(v, kdfParams map[string]interface{}) { v["created"] = "2000-01-01T00:00:00Z" }},
+		{"publickey", func(v, kdfParams map[string]interface{}) { v["publickey"] = otherPub }},
+	}
+
+	for _, cipher := range []string{CipherAES256GCM, CipherXChaCha20Poly1305} {
+		path := filepath.Join(t.TempDir(), "key.json")
+		opts := &Options{KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP, Cipher: cipher, Label: "test"}
+		if err := SaveAsKeystoreWithOptions(testKey, path, "password", opts); err != nil {
+			t.Fatal(err)
+		}
+		orig, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, tt := range tests {
+			var v map[string]interface{}
+			if err := json.Unmarshal(orig, &v); err != nil {
+				t.Fatal(err)
+			}
+			tt.tamper(v, v["crypto"].(map[string]interface{})["kdfparams"].(map[string]interface{}))
+			data, err := json.Marshal(v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, data, 0600); err != nil {
+				t.Fatal(err)
+			}
+			_, err = LoadPrivKeyFromKeystore(path, "password")
+			if tt.name == "none" {
+				// Re-encoding alone must not break authentication.
+				if err != nil {
+					t.Errorf("%s/%s: %v", cipher, tt.name, err)
+				}
+			} else if !errors.Is(err, ErrDecrypt) {
+				t.Errorf("%s/%s: got %v, want ErrDecrypt", cipher, tt.name, err)
+			}
+		}
+	}
+}
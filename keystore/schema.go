@@ -0,0 +1,275 @@
+package keystore
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 当前写入的keystore结构版本，旧格式("crtpto")为版本0
+const Version = 1
+
+var ErrUnsupportedVersion = errors.New("unsupported keystore version")
+
+// keystore文件结构，除Crypto外均为明文，不解密即可识别，AEAD加密时这些字段会被认证
+type Keystore struct {
+	Version   int        `json:"version"`
+	ID        string     `json:"id"`
+	PublicKey string     `json:"publickey,omitempty"`
+	CreatedAt time.Time  `json:"created"`
+	Label     string     `json:"label,omitempty"`
+	Crypto    cryptoJson `json:"crypto"`
+}
+
+// keystoreMetadata is the part of a Keystore that is bound to AEAD
+// ciphertexts as associated data.
+type keystoreMetadata struct {
+	Version   int       `json:"version"`
+	ID        string    `json:"id"`
+	PublicKey string    `json:"publickey,omitempty"`
+	CreatedAt time.Time `json:"created"`
+	Label     string    `json:"label,omitempty"`
+}
+
+func (ks *Keystore) UnmarshalJSON(data []byte) error {
+	type plain Keystore
+	var v struct {
+		plain
+		Legacy *cryptoJson `json:"crtpto"`
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	*ks = Keystore(v.plain)
+	if v.Legacy != nil && ks.Version == 0 {
+		ks.Crypto = *v.Legacy
+	}
+	return nil
+}
+
+// 判断是否为旧格式(版本0)，旧格式应使用Migrate升级
+func (ks *Keystore) IsLegacy() bool {
+	return ks.Version == 0
+}
+
+// metadata returns the associated data of the keystore's fields; legacy
+// files have none.
+func (ks *Keystore) metadata() ([]byte, error) {
+	if ks.IsLegacy() {
+		return nil, nil
+	}
+	return json.Marshal(keystoreMetadata{ks.Version, ks.ID, ks.PublicKey, ks.CreatedAt, ks.Label})
+}
+
+// 解密keystore中的私钥
+func (ks *Keystore) Decrypt(password string) ([]byte, error) {
+	if ks.Version > Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, ks.Version)
+	}
+
+	meta, err := ks.metadata()
+	if err != nil {
+		return nil, err
+	}
+	key, err := decryptData(ks.Crypto, password, meta)
+	if err != nil {
+		return nil, err
+	}
+
+	// aes-128-ctr does not authenticate the public key field, so check it
+	// against the decrypted key.
+	if ks.PublicKey != "" {
+		if pubKey := publicKeyOf(key); pubKey != nil && ks.PublicKey != hex.EncodeToString(pubKey) {
+			return nil, errors.New("keystore public key does not match the decrypted key")
+		}
+	}
+	return key, nil
+}
+
+// newKeystore encrypts key into a keystore with fresh metadata.
+func newKeystore(key []byte, password string, opts *Options) (*Keystore, error) {
+	id, err := newUUID()
+	if err != nil {
+		return nil, err
+	}
+
+	ks := &Keystore{
+		Version:   Version,
+		ID:        id,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	if opts != nil {
+		ks.Label = opts.Label
+	}
+	if pubKey := publicKeyOf(key); pubKey != nil {
+		ks.PublicKey = hex.EncodeToString(pubKey)
+	}
+
+	if err := ks.encrypt(key, password, opts); err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// encrypt replaces the crypto section, binding it to the current metadata.
+func (ks *Keystore) encrypt(key []byte, password string, opts *Options) error {
+	meta, err := ks.metadata()
+	if err != nil {
+		return err
+	}
+
+	c, err := encryptData(key, []byte(password), opts, meta)
+	if err != nil {
+		return err
+	}
+	ks.Crypto = c
+	return nil
+}
+
+// 读取keystore文件但不解密，可用于查看版本、ID和公钥
+func ReadKeystore(filepath string) (*Keystore, error) {
+	data, err := os.ReadFile(filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	var ks = new(Keystore)
+	if err := json.Unmarshal(data, ks); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// 将旧格式("crtpto")的keystore文件以原子方式原地升级为当前版本，沿用原有KDF，aes-128-ctr升级为aes-256-gcm
+func Migrate(filepath, password string) error {
+	ks, err := ReadKeystore(filepath)
+	if err != nil {
+		return err
+	}
+	if !ks.IsLegacy() {
+		return nil
+	}
+
+	key, err := ks.Decrypt(password)
+	if err != nil {
+		return err
+	}
+
+	opts, err := optionsFromCrypto(ks.Crypto)
+	if err != nil {
+		return err
+	}
+	// aes-128-ctr does not authenticate the metadata of the new version
+	if opts.Cipher == CipherAES128CTR {
+		opts.Cipher = CipherAES256GCM
+	}
+	newKs, err := newKeystore(key, password, opts)
+	if err != nil {
+		return err
+	}
+
+	js, err := json.Marshal(newKs)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath, js)
+}
+
+// optionsFromCrypto returns options that reproduce an existing crypto
+// section's KDF and cipher. PBKDF2 cannot be written and falls back to the
+// default KDF.
+func optionsFromCrypto(c cryptoJson) (*Options, error) {
+	opts := &Options{Cipher: c.Cipher}
+
+	switch c.KDF {
+	case KDFArgon2id:
+		v, err := kdfInts(c.KDFParams, "memory", "iterations", "parallelism")
+		if err != nil {
+			return nil, err
+		}
+		if err := checkArgon2Params(v[0], v[1], v[2]); err != nil {
+			return nil, err
+		}
+		opts.KDF = KDFArgon2id
+		opts.Argon2Memory = uint32(v[0])
+		opts.Argon2Iterations = uint32(v[1])
+		opts.Argon2Parallelism = uint8(v[2])
+	case KDFScrypt:
+		v, err := kdfInts(c.KDFParams, "n", "p")
+		if err != nil {
+			return nil, err
+		}
+		if err := checkScryptParams(v[0], scryptR, v[1]); err != nil {
+			return nil, err
+		}
+		opts.KDF = KDFScrypt
+		opts.ScryptN = v[0]
+		opts.ScryptP = v[1]
+	}
+	return opts, nil
+}
+
+// writeFileAtomic replaces path with js: it is written to a temporary file
+// in the same directory, synced and renamed into place, so readers never
+// see a partial file. An existing file keeps its permissions; new files are
+// created with mode 0600.
+func writeFileAtomic(path string, js []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if fi, err := os.Stat(path); err == nil {
+		if err := f.Chmod(fi.Mode().Perm()); err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	if _, err := f.Write(js); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// publicKeyOf returns the public key of an Ed25519 private key, or nil if
+// key is not one.
+func publicKeyOf(key []byte) []byte {
+	if len(key) != ed25519.PrivateKeySize {
+		return nil
+	}
+	return ed25519.PrivateKey(key).Public().(ed25519.PublicKey)
+}
+
+// newUUID returns a random (version 4) UUID.
+func newUUID() (string, error) {
+	var u [16]byte
+	if _, err := io.ReadFull(rand.Reader, u[:]); err != nil {
+		return "", fmt.Errorf("reading from crypto/rand failed: %w", err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
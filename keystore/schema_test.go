@@ -0,0 +1,81 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDefaultCipher(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		opts   *Options
+		cipher string
+	}{
+		{LightOptions(), CipherAES256GCM},
+		{&Options{KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP}, CipherAES256GCM},
+		{&Options{KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP, Cipher: CipherAES128CTR}, CipherAES128CTR},
+		{&Options{Format: FormatWeb3V3, ScryptN: LightScryptN, ScryptP: LightScryptP}, CipherAES128CTR},
+	}
+	for i, tt := range tests {
+		path := filepath.Join(dir, "key.json")
+		if err := SaveAsKeystoreWithOptions(testKey, path, "password", tt.opts); err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var v struct {
+			Crypto struct {
+				Cipher string `json:"cipher"`
+			} `json:"crypto"`
+		}
+		if err := json.Unmarshal(data, &v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Crypto.Cipher != tt.cipher {
+			t.Errorf("%d: cipher = %q, want %q", i, v.Crypto.Cipher, tt.cipher)
+		}
+		key, err := LoadPrivKeyFromKeystore(path, "password")
+		if err != nil || !bytes.Equal(key, testKey) {
+			t.Errorf("%d: load failed: %v", i, err)
+		}
+	}
+}
+
+func TestMigrateUpgradesCTR(t *testing.T) {
+	opts := &Options{KDF: KDFScrypt, ScryptN: LightScryptN, ScryptP: LightScryptP, Cipher: CipherAES128CTR}
+	c, err := encryptData(testKey, []byte("password"), opts, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(map[string]interface{}{"crtpto": c})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "legacy.json")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Migrate(path, "password"); err != nil {
+		t.Fatal(err)
+	}
+	ks, err := ReadKeystore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ks.IsLegacy() || ks.Version != Version {
+		t.Fatalf("version = %d after Migrate", ks.Version)
+	}
+	if ks.Crypto.Cipher != CipherAES256GCM || ks.Crypto.KDF != KDFScrypt {
+		t.Fatalf("migrated to %s/%s, want %s/%s", ks.Crypto.KDF, ks.Crypto.Cipher, KDFScrypt, CipherAES256GCM)
+	}
+	key, err := ks.Decrypt("password")
+	if err != nil || !bytes.Equal(key, testKey) {
+		t.Fatalf("Decrypt after Migrate: %v", err)
+	}
+}
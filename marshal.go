@@ -0,0 +1,415 @@
+package key25519
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lyonnee/key25519/format"
+)
+
+// Encoding selects the text form used when marshaling keys.
+type Encoding int
+
+const (
+	// EncodingDefault defers to DefaultEncoding.
+	EncodingDefault Encoding = iota
+	EncodingHex
+	EncodingBase58
+	EncodingBase64
+)
+
+// DefaultEncoding is the text encoding used by the key types and by wrappers
+// left at EncodingDefault. It is read without synchronization, so it may only
+// be set during program initialization, before any key is marshaled;
+// changing it while other goroutines marshal keys is a data race. Code that
+// needs a different encoding later should use the Encoded* wrappers instead.
+var DefaultEncoding = EncodingHex
+
+// redacted is what a PrivateKey marshals to unless it is wrapped in an
+// EncodedPrivateKey.
+const redacted = "REDACTED"
+
+var (
+	_ encoding.TextMarshaler     = PublicKey{}
+	_ encoding.TextUnmarshaler   = (*PublicKey)(nil)
+	_ encoding.BinaryMarshaler   = PublicKey{}
+	_ encoding.BinaryUnmarshaler = (*PublicKey)(nil)
+	_ json.Marshaler             = PublicKey{}
+	_ json.Unmarshaler           = (*PublicKey)(nil)
+	_ driver.Valuer              = PublicKey{}
+	_ sql.Scanner                = (*PublicKey)(nil)
+
+	_ encoding.TextMarshaler     = PrivateKey{}
+	_ encoding.TextUnmarshaler   = (*PrivateKey)(nil)
+	_ encoding.BinaryMarshaler   = PrivateKey{}
+	_ encoding.BinaryUnmarshaler = (*PrivateKey)(nil)
+	_ json.Marshaler             = PrivateKey{}
+	_ json.Unmarshaler           = (*PrivateKey)(nil)
+	_ driver.Valuer              = PrivateKey{}
+	_ sql.Scanner                = (*PrivateKey)(nil)
+
+	_ json.Marshaler   = (*KeyPair)(nil)
+	_ json.Unmarshaler = (*KeyPair)(nil)
+)
+
+func (e Encoding) resolve() Encoding {
+	if e == EncodingDefault {
+		return DefaultEncoding
+	}
+	return e
+}
+
+func (e Encoding) String() string {
+	switch e.resolve() {
+	case EncodingHex:
+		return "hex"
+	case EncodingBase58:
+		return "base58"
+	case EncodingBase64:
+		return "base64"
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// EncodeToString encodes d in the encoding e.
+func (e Encoding) EncodeToString(d []byte) string {
+	switch e.resolve() {
+	case EncodingBase58:
+		return format.EncodeBase58(d)
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString(d)
+	default:
+		return hex.EncodeToString(d)
+	}
+}
+
+// DecodeString decodes s from the encoding e.
+func (e Encoding) DecodeString(s string) ([]byte, error) {
+	switch e.resolve() {
+	case EncodingHex:
+		return hex.DecodeString(s)
+	case EncodingBase58:
+		return format.DecodeBase58(s)
+	case EncodingBase64:
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return nil, fmt.Errorf("key25519: unknown encoding %d", int(e))
+}
+
+// MarshalText encodes the key with DefaultEncoding.
+func (pk PublicKey) MarshalText() ([]byte, error) {
+	return marshalText(pk[:], EncodingDefault)
+}
+
+// UnmarshalText decodes a key encoded with DefaultEncoding and validates it.
+func (pk *PublicKey) UnmarshalText(text []byte) error {
+	return pk.unmarshalText(text, EncodingDefault)
+}
+
+func (pk PublicKey) MarshalJSON() ([]byte, error) {
+	return marshalJSON(pk)
+}
+
+func (pk *PublicKey) UnmarshalJSON(data []byte) error {
+	return unmarshalJSON(data, pk)
+}
+
+// MarshalBinary returns the raw 32-byte key.
+func (pk PublicKey) MarshalBinary() ([]byte, error) {
+	return bytes.Clone(pk[:]), nil
+}
+
+func (pk *PublicKey) UnmarshalBinary(data []byte) error {
+	return pk.LoadFromBytes(data)
+}
+
+// Value stores the key as raw bytes.
+func (pk PublicKey) Value() (driver.Value, error) {
+	return pk.MarshalBinary()
+}
+
+// Scan reads raw key bytes, or text in DefaultEncoding.
+func (pk *PublicKey) Scan(src any) error {
+	return pk.scan(src, EncodingDefault)
+}
+
+func (pk *PublicKey) unmarshalText(text []byte, e Encoding) error {
+	d, err := e.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return pk.LoadFromBytes(d)
+}
+
+func (pk *PublicKey) scan(src any, e Encoding) error {
+	switch v := src.(type) {
+	case []byte:
+		if len(v) == PublicKeyLength {
+			return pk.LoadFromBytes(v)
+		}
+		return pk.unmarshalText(v, e)
+	case string:
+		return pk.unmarshalText([]byte(v), e)
+	}
+	return fmt.Errorf("key25519: cannot scan %T into PublicKey", src)
+}
+
+// MarshalText returns a redacted placeholder, so that private keys do not
+// leak into logs or configs by accident. Wrap the key in an
+// EncodedPrivateKey to marshal its contents.
+func (pk PrivateKey) MarshalText() ([]byte, error) {
+	return []byte(redacted), nil
+}
+
+// UnmarshalText decodes a key encoded with DefaultEncoding and validates it.
+func (pk *PrivateKey) UnmarshalText(text []byte) error {
+	return pk.unmarshalText(text, EncodingDefault)
+}
+
+// MarshalJSON returns a redacted placeholder; see MarshalText.
+func (pk PrivateKey) MarshalJSON() ([]byte, error) {
+	return marshalJSON(pk)
+}
+
+func (pk *PrivateKey) UnmarshalJSON(data []byte) error {
+	return unmarshalJSON(data, pk)
+}
+
+// MarshalBinary fails with ErrRedacted, as there is no placeholder for raw
+// bytes. Wrap the key in an EncodedPrivateKey to marshal its contents.
+func (pk PrivateKey) MarshalBinary() ([]byte, error) {
+	return nil, ErrRedacted
+}
+
+func (pk *PrivateKey) UnmarshalBinary(data []byte) error {
+	return pk.LoadFromBytes(data)
+}
+
+// Value fails with ErrRedacted; see MarshalBinary.
+func (pk PrivateKey) Value() (driver.Value, error) {
+	return nil, ErrRedacted
+}
+
+// Scan reads raw key bytes, or text in DefaultEncoding.
+func (pk *PrivateKey) Scan(src any) error {
+	return pk.scan(src, EncodingDefault)
+}
+
+func (pk *PrivateKey) unmarshalText(text []byte, e Encoding) error {
+	if string(text) == redacted {
+		return ErrRedacted
+	}
+
+	d, err := e.DecodeString(string(text))
+	if err != nil {
+		return err
+	}
+	return pk.LoadFromBytes(d)
+}
+
+func (pk *PrivateKey) scan(src any, e Encoding) error {
+	switch v := src.(type) {
+	case []byte:
+		if len(v) == PrivateKeyLength {
+			return pk.LoadFromBytes(v)
+		}
+		return pk.unmarshalText(v, e)
+	case string:
+		return pk.unmarshalText([]byte(v), e)
+	}
+	return fmt.Errorf("key25519: cannot scan %T into PrivateKey", src)
+}
+
+// EncodedPublicKey marshals Key with its own Encoding instead of
+// DefaultEncoding. As a driver.Valuer it stores the encoded text rather than
+// raw bytes.
+type EncodedPublicKey struct {
+	Key      PublicKey
+	Encoding Encoding
+}
+
+func (k EncodedPublicKey) MarshalText() ([]byte, error) {
+	return marshalText(k.Key[:], k.Encoding)
+}
+
+func (k *EncodedPublicKey) UnmarshalText(text []byte) error {
+	return k.Key.unmarshalText(text, k.Encoding)
+}
+
+func (k EncodedPublicKey) MarshalJSON() ([]byte, error) {
+	return marshalJSON(k)
+}
+
+func (k *EncodedPublicKey) UnmarshalJSON(data []byte) error {
+	return unmarshalJSON(data, k)
+}
+
+func (k EncodedPublicKey) MarshalBinary() ([]byte, error) {
+	return k.Key.MarshalBinary()
+}
+
+func (k *EncodedPublicKey) UnmarshalBinary(data []byte) error {
+	return k.Key.UnmarshalBinary(data)
+}
+
+func (k EncodedPublicKey) Value() (driver.Value, error) {
+	return k.Encoding.EncodeToString(k.Key[:]), nil
+}
+
+func (k *EncodedPublicKey) Scan(src any) error {
+	return k.Key.scan(src, k.Encoding)
+}
+
+// EncodedPrivateKey opts Key into being marshaled in clear, using its own
+// Encoding. Only wrap keys that are meant to be persisted.
+type EncodedPrivateKey struct {
+	Key      PrivateKey
+	Encoding Encoding
+}
+
+func (k EncodedPrivateKey) MarshalText() ([]byte, error) {
+	return marshalText(k.Key[:], k.Encoding)
+}
+
+func (k *EncodedPrivateKey) UnmarshalText(text []byte) error {
+	return k.Key.unmarshalText(text, k.Encoding)
+}
+
+func (k EncodedPrivateKey) MarshalJSON() ([]byte, error) {
+	return marshalJSON(k)
+}
+
+func (k *EncodedPrivateKey) UnmarshalJSON(data []byte) error {
+	return unmarshalJSON(data, k)
+}
+
+func (k EncodedPrivateKey) MarshalBinary() ([]byte, error) {
+	return bytes.Clone(k.Key[:]), nil
+}
+
+func (k *EncodedPrivateKey) UnmarshalBinary(data []byte) error {
+	return k.Key.UnmarshalBinary(data)
+}
+
+func (k EncodedPrivateKey) Value() (driver.Value, error) {
+	return k.Encoding.EncodeToString(k.Key[:]), nil
+}
+
+func (k *EncodedPrivateKey) Scan(src any) error {
+	return k.Key.scan(src, k.Encoding)
+}
+
+type keyPairJSON struct {
+	PublicKey  json.RawMessage `json:"publicKey"`
+	PrivateKey json.RawMessage `json:"privateKey"`
+}
+
+// MarshalJSON encodes the public key and a redacted private key. Use
+// EncodedKeyPair to include the private key. A nil key pair encodes as null.
+func (kp *KeyPair) MarshalJSON() ([]byte, error) {
+	return EncodedKeyPair{KeyPair: kp, redact: true}.MarshalJSON()
+}
+
+// UnmarshalJSON reads a key pair written by EncodedKeyPair. The public key,
+// if present, must match the private key.
+func (kp *KeyPair) UnmarshalJSON(data []byte) error {
+	return (&EncodedKeyPair{KeyPair: kp}).UnmarshalJSON(data)
+}
+
+// EncodedKeyPair marshals a KeyPair as JSON including its private key, with
+// both keys in Encoding. A nil KeyPair marshals as null, and unmarshaling null
+// leaves KeyPair untouched.
+type EncodedKeyPair struct {
+	KeyPair  *KeyPair
+	Encoding Encoding
+
+	redact bool
+}
+
+func (k EncodedKeyPair) MarshalJSON() ([]byte, error) {
+	if k.KeyPair == nil {
+		return []byte("null"), nil
+	}
+
+	var (
+		v   keyPairJSON
+		err error
+	)
+	if v.PublicKey, err = json.Marshal(EncodedPublicKey{k.KeyPair.pubKey, k.Encoding}); err != nil {
+		return nil, err
+	}
+
+	var priv json.Marshaler = EncodedPrivateKey{k.KeyPair.privKey, k.Encoding}
+	if k.redact {
+		priv = k.KeyPair.privKey
+	}
+	if v.PrivateKey, err = priv.MarshalJSON(); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(v)
+}
+
+func (k *EncodedKeyPair) UnmarshalJSON(data []byte) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+
+	var v keyPairJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	privKey := EncodedPrivateKey{Encoding: k.Encoding}
+	if err := json.Unmarshal(v.PrivateKey, &privKey); err != nil {
+		return err
+	}
+	pubKey := privKey.Key.GetPubKey()
+
+	if len(v.PublicKey) > 0 && string(v.PublicKey) != "null" {
+		declared := EncodedPublicKey{Encoding: k.Encoding}
+		if err := json.Unmarshal(v.PublicKey, &declared); err != nil {
+			return err
+		}
+		if declared.Key != pubKey {
+			return ErrKeyMismatch
+		}
+	}
+
+	if k.KeyPair == nil {
+		k.KeyPair = new(KeyPair)
+	}
+	*k.KeyPair = KeyPair{privKey: privKey.Key, pubKey: pubKey}
+	return nil
+}
+
+func marshalText(d []byte, e Encoding) ([]byte, error) {
+	return []byte(e.EncodeToString(d)), nil
+}
+
+func marshalJSON(m encoding.TextMarshaler) ([]byte, error) {
+	text, err := m.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(string(text))
+}
+
+// unmarshalJSON treats null as a no-op, following encoding/json.
+func unmarshalJSON(data []byte, u encoding.TextUnmarshaler) error {
+	if string(bytes.TrimSpace(data)) == "null" {
+		return nil
+	}
+
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	return u.UnmarshalText([]byte(s))
+}
@@ -0,0 +1,242 @@
+package key25519
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestKeyPairJSONRoundTrip(t *testing.T) {
+	kp := NewKeyPair()
+	for _, e := range []Encoding{EncodingHex, EncodingBase58, EncodingBase64} {
+		data, err := json.Marshal(EncodedKeyPair{KeyPair: kp, Encoding: e})
+		if err != nil {
+			t.Fatalf("%v: %v", e, err)
+		}
+		got := EncodedKeyPair{Encoding: e}
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatalf("%v: %v", e, err)
+		}
+		if got.KeyPair.PrivateKey() != kp.PrivateKey() || got.KeyPair.PublicKey() != kp.PublicKey() {
+			t.Fatalf("%v: key pair did not round-trip", e)
+		}
+	}
+}
+
+func TestKeyPairJSONRedacted(t *testing.T) {
+	kp := NewKeyPair()
+	data, err := json.Marshal(kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]string
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["privateKey"] != redacted {
+		t.Fatalf("private key = %q, want %q", v["privateKey"], redacted)
+	}
+	if err := new(KeyPair).UnmarshalJSON(data); !errors.Is(err, ErrRedacted) {
+		t.Fatalf("UnmarshalJSON of redacted key pair = %v, want ErrRedacted", err)
+	}
+}
+
+func TestKeyPairJSONNil(t *testing.T) {
+	var kp *KeyPair
+	data, err := kp.MarshalJSON()
+	if err != nil || string(data) != "null" {
+		t.Fatalf("(*KeyPair)(nil).MarshalJSON() = %s, %v", data, err)
+	}
+	if data, err = (EncodedKeyPair{}).MarshalJSON(); err != nil || string(data) != "null" {
+		t.Fatalf("EncodedKeyPair{}.MarshalJSON() = %s, %v", data, err)
+	}
+
+	var v struct {
+		KeyPair *KeyPair
+		Encoded EncodedKeyPair
+	}
+	data, err = json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"KeyPair":null,"Encoded":null}`; string(data) != want {
+		t.Fatalf("got %s, want %s", data, want)
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.KeyPair != nil || v.Encoded.KeyPair != nil {
+		t.Fatal("unmarshaling null produced a key pair")
+	}
+}
+
+func TestKeyPairJSONMismatch(t *testing.T) {
+	a, b := NewKeyPair(), NewKeyPair()
+	data, err := json.Marshal(map[string]EncodedPrivateKey{
+		"privateKey": {Key: a.PrivateKey()},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]any
+	if err := json.Unmarshal(data, &v); err != nil {
+		t.Fatal(err)
+	}
+	v["publicKey"] = b.PublicKey()
+	if data, err = json.Marshal(v); err != nil {
+		t.Fatal(err)
+	}
+	if err := new(KeyPair).UnmarshalJSON(data); !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("got %v, want ErrKeyMismatch", err)
+	}
+}
+
+func TestKeyTextEncodings(t *testing.T) {
+	kp := NewKeyPair()
+	for _, e := range []Encoding{EncodingHex, EncodingBase58, EncodingBase64} {
+		text, err := EncodedPublicKey{kp.PublicKey(), e}.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(text) != e.EncodeToString(kp.PublicKey().Bytes()) {
+			t.Errorf("%v: public key text = %s", e, text)
+		}
+		pub := EncodedPublicKey{Encoding: e}
+		if err := pub.UnmarshalText(text); err != nil || pub.Key != kp.PublicKey() {
+			t.Errorf("%v: public key did not round-trip: %v", e, err)
+		}
+
+		text, err = EncodedPrivateKey{kp.PrivateKey(), e}.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv := EncodedPrivateKey{Encoding: e}
+		if err := priv.UnmarshalText(text); err != nil || priv.Key != kp.PrivateKey() {
+			t.Errorf("%v: private key did not round-trip: %v", e, err)
+		}
+	}
+}
+
+// TestDefaultEncodingText changes DefaultEncoding and so must not run in
+// parallel with other tests.
+func TestDefaultEncodingText(t *testing.T) {
+	defer func(e Encoding) { DefaultEncoding = e }(DefaultEncoding)
+
+	kp := NewKeyPair()
+	for _, e := range []Encoding{EncodingHex, EncodingBase58, EncodingBase64} {
+		DefaultEncoding = e
+
+		text, err := kp.PublicKey().MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(text) != e.EncodeToString(kp.PublicKey().Bytes()) {
+			t.Errorf("%v: PublicKey.MarshalText = %s", e, text)
+		}
+		var pub PublicKey
+		if err := pub.UnmarshalText(text); err != nil || pub != kp.PublicKey() {
+			t.Errorf("%v: PublicKey.UnmarshalText: %v", e, err)
+		}
+
+		var priv PrivateKey
+		text = []byte(e.EncodeToString(kp.PrivateKey().Bytes()))
+		if err := priv.UnmarshalText(text); err != nil || priv != kp.PrivateKey() {
+			t.Errorf("%v: PrivateKey.UnmarshalText: %v", e, err)
+		}
+	}
+}
+
+func TestPrivateKeyRedacted(t *testing.T) {
+	privKey := NewKeyPair().PrivateKey()
+
+	if text, err := privKey.MarshalText(); err != nil || string(text) != redacted {
+		t.Errorf("MarshalText = %s, %v", text, err)
+	}
+	if data, err := json.Marshal(privKey); err != nil || string(data) != `"`+redacted+`"` {
+		t.Errorf("json.Marshal = %s, %v", data, err)
+	}
+	if _, err := privKey.MarshalBinary(); !errors.Is(err, ErrRedacted) {
+		t.Errorf("MarshalBinary: got %v, want ErrRedacted", err)
+	}
+	if _, err := privKey.Value(); !errors.Is(err, ErrRedacted) {
+		t.Errorf("Value: got %v, want ErrRedacted", err)
+	}
+	if err := new(PrivateKey).UnmarshalText([]byte(redacted)); !errors.Is(err, ErrRedacted) {
+		t.Errorf("UnmarshalText of the placeholder: got %v, want ErrRedacted", err)
+	}
+
+	wrapped := EncodedPrivateKey{Key: privKey, Encoding: EncodingBase64}
+	if text, err := wrapped.MarshalText(); err != nil || string(text) != EncodingBase64.EncodeToString(privKey[:]) {
+		t.Errorf("EncodedPrivateKey.MarshalText = %s, %v", text, err)
+	}
+	if b, err := wrapped.MarshalBinary(); err != nil || !bytes.Equal(b, privKey[:]) {
+		t.Errorf("EncodedPrivateKey.MarshalBinary: %v", err)
+	}
+	if v, err := wrapped.Value(); err != nil || v != EncodingBase64.EncodeToString(privKey[:]) {
+		t.Errorf("EncodedPrivateKey.Value = %v, %v", v, err)
+	}
+}
+
+func TestScanValue(t *testing.T) {
+	kp := NewKeyPair()
+	pubKey, privKey := kp.PublicKey(), kp.PrivateKey()
+
+	v, err := pubKey.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, ok := v.([]byte)
+	if !ok || !bytes.Equal(raw, pubKey[:]) {
+		t.Fatalf("PublicKey.Value = %v", v)
+	}
+
+	for _, src := range []any{raw, hex.EncodeToString(raw), []byte(hex.EncodeToString(raw))} {
+		var got PublicKey
+		if err := got.Scan(src); err != nil || got != pubKey {
+			t.Errorf("PublicKey.Scan(%T): %v", src, err)
+		}
+	}
+	for _, src := range []any{privKey[:], hex.EncodeToString(privKey[:])} {
+		var got PrivateKey
+		if err := got.Scan(src); err != nil || got != privKey {
+			t.Errorf("PrivateKey.Scan(%T): %v", src, err)
+		}
+	}
+	if err := new(PublicKey).Scan(42); err == nil {
+		t.Error("PublicKey.Scan accepted an int")
+	}
+
+	// The wrappers store and scan text in their own encoding.
+	enc := EncodedPublicKey{pubKey, EncodingBase58}
+	v, err = enc.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := EncodedPublicKey{Encoding: EncodingBase58}
+	if err := got.Scan(v); err != nil || got.Key != pubKey {
+		t.Errorf("EncodedPublicKey.Scan: %v", err)
+	}
+}
+
+func TestUnmarshalJSONNull(t *testing.T) {
+	kp := NewKeyPair()
+	v := struct {
+		Pub  PublicKey
+		Priv PrivateKey
+		Enc  EncodedPublicKey
+	}{kp.PublicKey(), kp.PrivateKey(), EncodedPublicKey{Key: kp.PublicKey()}}
+
+	if err := json.Unmarshal([]byte(`{"Pub":null,"Priv":null,"Enc":null}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Pub != kp.PublicKey() || v.Priv != kp.PrivateKey() || v.Enc.Key != kp.PublicKey() {
+		t.Fatal("unmarshaling null changed the keys")
+	}
+
+	pub := kp.PublicKey()
+	if err := pub.UnmarshalJSON([]byte("null")); err != nil || pub != kp.PublicKey() {
+		t.Fatalf("PublicKey.UnmarshalJSON(null) = %v", err)
+	}
+}
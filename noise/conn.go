@@ -0,0 +1,188 @@
+package noise
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Handshake and transport messages are framed with a 2-byte big-endian
+// length prefix, as recommended by the Noise specification.
+
+const (
+	maxMsgLen     = 65535
+	maxPayloadLen = maxMsgLen - 16
+)
+
+// Conn is an encrypted, authenticated connection established with a Noise
+// handshake. It implements net.Conn.
+type Conn struct {
+	conn   net.Conn
+	config Config
+
+	handshakeMu   sync.Mutex
+	handshakeErr  error
+	handshakeDone bool
+	peerStatic    []byte
+	binding       []byte
+
+	in, out *CipherState
+	readMu  sync.Mutex
+	readBuf []byte
+	writeMu sync.Mutex
+}
+
+// Client returns a connection running the initiator side of the handshake
+// described by config on conn.
+func Client(conn net.Conn, config Config) *Conn {
+	config.Initiator = true
+	return &Conn{conn: conn, config: config}
+}
+
+// Server returns a connection running the responder side of the handshake
+// described by config on conn.
+func Server(conn net.Conn, config Config) *Conn {
+	config.Initiator = false
+	return &Conn{conn: conn, config: config}
+}
+
+// Handshake runs the handshake if it has not run yet. Read and Write call
+// it automatically.
+func (c *Conn) Handshake() error {
+	c.handshakeMu.Lock()
+	defer c.handshakeMu.Unlock()
+
+	if c.handshakeDone || c.handshakeErr != nil {
+		return c.handshakeErr
+	}
+	c.handshakeErr = c.handshake()
+	c.handshakeDone = c.handshakeErr == nil
+	return c.handshakeErr
+}
+
+func (c *Conn) handshake() error {
+	hs, err := NewHandshakeState(c.config)
+	if err != nil {
+		return err
+	}
+
+	for {
+		var msg []byte
+		var out, in *CipherState
+		if hs.isInitiatorTurn() == c.config.Initiator {
+			if msg, out, in, err = hs.WriteMessage(nil, nil); err != nil {
+				return err
+			}
+			if err := c.writeFrame(msg); err != nil {
+				return err
+			}
+		} else {
+			if msg, err = c.readFrame(); err != nil {
+				return err
+			}
+			if _, out, in, err = hs.ReadMessage(nil, msg); err != nil {
+				return err
+			}
+		}
+
+		if out != nil {
+			c.out, c.in = out, in
+			c.peerStatic = hs.PeerStatic()
+			c.binding = hs.ChannelBinding()
+			return nil
+		}
+	}
+}
+
+// PeerStatic returns the peer's static public key after the handshake.
+func (c *Conn) PeerStatic() []byte {
+	return c.peerStatic
+}
+
+// ChannelBinding returns the handshake hash after the handshake.
+func (c *Conn) ChannelBinding() []byte {
+	return c.binding
+}
+
+func (c *Conn) Read(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for len(c.readBuf) == 0 {
+		msg, err := c.readFrame()
+		if err != nil {
+			return 0, err
+		}
+		if c.readBuf, err = c.in.Decrypt(msg[:0], nil, msg); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(b, c.readBuf)
+	c.readBuf = c.readBuf[n:]
+	return n, nil
+}
+
+func (c *Conn) Write(b []byte) (int, error) {
+	if err := c.Handshake(); err != nil {
+		return 0, err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	n := 0
+	for len(b) > 0 {
+		chunk := b
+		if len(chunk) > maxPayloadLen {
+			chunk = chunk[:maxPayloadLen]
+		}
+		msg, err := c.out.Encrypt(nil, nil, chunk)
+		if err != nil {
+			return n, err
+		}
+		if err := c.writeFrame(msg); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		b = b[len(chunk):]
+	}
+	return n, nil
+}
+
+func (c *Conn) writeFrame(msg []byte) error {
+	if len(msg) > maxMsgLen {
+		return errors.New("noise: message too large")
+	}
+	frame := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	copy(frame[2:], msg)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+func (c *Conn) readFrame() ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(c.conn, size[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(c.conn, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func (c *Conn) Close() error                       { return c.conn.Close() }
+func (c *Conn) LocalAddr() net.Addr                { return c.conn.LocalAddr() }
+func (c *Conn) RemoteAddr() net.Addr               { return c.conn.RemoteAddr() }
+func (c *Conn) SetDeadline(t time.Time) error      { return c.conn.SetDeadline(t) }
+func (c *Conn) SetReadDeadline(t time.Time) error  { return c.conn.SetReadDeadline(t) }
+func (c *Conn) SetWriteDeadline(t time.Time) error { return c.conn.SetWriteDeadline(t) }
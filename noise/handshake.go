@@ -0,0 +1,323 @@
+// Package noise implements the Noise Protocol Framework (revision 34) for
+// the XX, IK and NK handshake patterns over Curve25519 and ChaChaPoly, with
+// BLAKE2s or SHA256 as the hash. Static keys are x25519 key pairs, such as
+// those returned by key25519.KeyPair.ExportEcdhKeyPairScheme.
+package noise
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+const dhLen = 32
+
+type token uint8
+
+const (
+	tokenE token = iota
+	tokenS
+	tokenEE
+	tokenES
+	tokenSE
+	tokenSS
+)
+
+// HandshakePattern describes a Noise handshake.
+type HandshakePattern struct {
+	Name string
+	// responderPreMessage is set when the initiator knows the responder's
+	// static key before the handshake ("<- s").
+	responderPreMessage bool
+	messages            [][]token
+}
+
+var (
+	PatternXX = HandshakePattern{
+		Name: "XX",
+		messages: [][]token{
+			{tokenE},
+			{tokenE, tokenEE, tokenS, tokenES},
+			{tokenS, tokenSE},
+		},
+	}
+	PatternIK = HandshakePattern{
+		Name:                "IK",
+		responderPreMessage: true,
+		messages: [][]token{
+			{tokenE, tokenES, tokenS, tokenSS},
+			{tokenE, tokenEE, tokenSE},
+		},
+	}
+	PatternNK = HandshakePattern{
+		Name:                "NK",
+		responderPreMessage: true,
+		messages: [][]token{
+			{tokenE, tokenES},
+			{tokenE, tokenEE},
+		},
+	}
+)
+
+var (
+	ErrShortMessage     = errors.New("noise: message is too short")
+	ErrHandshakeDone    = errors.New("noise: handshake is already complete")
+	ErrUnexpectedCall   = errors.New("noise: it is not this party's turn to write")
+	ErrMissingStaticKey = errors.New("noise: handshake pattern requires a static key")
+	// ErrPeerStaticRejected is returned when Config.VerifyPeerStatic rejects
+	// the peer's static key.
+	ErrPeerStaticRejected = errors.New("noise: peer static key rejected")
+)
+
+// Config configures one side of a handshake.
+type Config struct {
+	Pattern   HandshakePattern
+	Hash      HashFunc
+	Initiator bool
+	Prologue  []byte
+	// StaticKeypair is the local static key, required unless the pattern
+	// starts with N on this side.
+	StaticKeypair *x25519.KeyPair
+	// PeerStatic is the responder's static public key, required for IK and
+	// NK initiators.
+	PeerStatic []byte
+	// VerifyPeerStatic, if set, is called with the peer's static public key
+	// as soon as it is received during the handshake, before the transport
+	// keys are split. An error aborts the handshake.
+	VerifyPeerStatic func(peerStatic []byte) error
+	// Random is the source of ephemeral keys, crypto/rand if nil.
+	Random io.Reader
+	// EphemeralKeypair fixes the ephemeral key; it exists for test vectors.
+	EphemeralKeypair *x25519.KeyPair
+}
+
+// ProtocolName returns the full Noise protocol name of the configuration.
+func (c *Config) ProtocolName() string {
+	return "Noise_" + c.Pattern.Name + "_25519_ChaChaPoly_" + c.Hash.name()
+}
+
+// HandshakeState runs a handshake and yields the transport cipher states.
+type HandshakeState struct {
+	ss        symmetricState
+	s, e      *x25519.KeyPair
+	rs, re    []byte
+	initiator bool
+	random    io.Reader
+	messages  [][]token
+	turn      int
+
+	verifyPeerStatic func([]byte) error
+}
+
+func NewHandshakeState(c Config) (*HandshakeState, error) {
+	hs := &HandshakeState{
+		s:         c.StaticKeypair,
+		e:         c.EphemeralKeypair,
+		initiator: c.Initiator,
+		random:    c.Random,
+		messages:  c.Pattern.messages,
+
+		verifyPeerStatic: c.VerifyPeerStatic,
+	}
+	if hs.random == nil {
+		hs.random = rand.Reader
+	}
+	if len(c.PeerStatic) > 0 {
+		hs.rs = append([]byte(nil), c.PeerStatic...)
+	}
+
+	hs.ss.initialize(c.Hash, c.ProtocolName())
+	hs.ss.mixHash(c.Prologue)
+
+	if c.Pattern.responderPreMessage {
+		if c.Initiator {
+			if len(hs.rs) != dhLen {
+				return nil, ErrMissingStaticKey
+			}
+			hs.ss.mixHash(hs.rs)
+		} else {
+			if hs.s == nil {
+				return nil, ErrMissingStaticKey
+			}
+			hs.ss.mixHash(hs.s.PublicKey)
+		}
+	}
+
+	return hs, nil
+}
+
+// WriteMessage appends the next handshake message carrying payload to out.
+// Once the handshake completes it also returns the cipher states for
+// sending and receiving, in that order.
+func (hs *HandshakeState) WriteMessage(out, payload []byte) ([]byte, *CipherState, *CipherState, error) {
+	if hs.turn >= len(hs.messages) {
+		return nil, nil, nil, ErrHandshakeDone
+	}
+	if hs.isInitiatorTurn() != hs.initiator {
+		return nil, nil, nil, ErrUnexpectedCall
+	}
+
+	var err error
+	for _, t := range hs.messages[hs.turn] {
+		switch t {
+		case tokenE:
+			if hs.e == nil {
+				if hs.e, err = generateKeypair(hs.random); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			out = append(out, hs.e.PublicKey...)
+			hs.ss.mixHash(hs.e.PublicKey)
+		case tokenS:
+			if hs.s == nil {
+				return nil, nil, nil, ErrMissingStaticKey
+			}
+			if out, err = hs.ss.encryptAndHash(out, hs.s.PublicKey); err != nil {
+				return nil, nil, nil, err
+			}
+		default:
+			if err := hs.mixDH(t); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	if out, err = hs.ss.encryptAndHash(out, payload); err != nil {
+		return nil, nil, nil, err
+	}
+
+	cs1, cs2 := hs.advance()
+	return out, cs1, cs2, nil
+}
+
+// ReadMessage processes the next handshake message and appends its payload
+// to out. Once the handshake completes it also returns the cipher states for
+// sending and receiving, in that order. A message that fails to process
+// leaves the handshake state unchanged.
+func (hs *HandshakeState) ReadMessage(out, message []byte) (_ []byte, _ *CipherState, _ *CipherState, err error) {
+	if hs.turn >= len(hs.messages) {
+		return nil, nil, nil, ErrHandshakeDone
+	}
+	if hs.isInitiatorTurn() == hs.initiator {
+		return nil, nil, nil, ErrUnexpectedCall
+	}
+
+	ss, rs, re := hs.ss, hs.rs, hs.re
+	defer func() {
+		if err != nil {
+			hs.ss, hs.rs, hs.re = ss, rs, re
+		}
+	}()
+
+	for _, t := range hs.messages[hs.turn] {
+		switch t {
+		case tokenE:
+			if len(message) < dhLen {
+				return nil, nil, nil, ErrShortMessage
+			}
+			hs.re = append([]byte(nil), message[:dhLen]...)
+			message = message[dhLen:]
+			hs.ss.mixHash(hs.re)
+		case tokenS:
+			size := dhLen
+			if hs.ss.cs.hasKey() {
+				size += 16
+			}
+			if len(message) < size {
+				return nil, nil, nil, ErrShortMessage
+			}
+			if hs.rs, err = hs.ss.decryptAndHash(nil, message[:size]); err != nil {
+				return nil, nil, nil, err
+			}
+			if hs.verifyPeerStatic != nil {
+				if err = hs.verifyPeerStatic(hs.rs); err != nil {
+					return nil, nil, nil, fmt.Errorf("%w: %v", ErrPeerStaticRejected, err)
+				}
+			}
+			message = message[size:]
+		default:
+			if err = hs.mixDH(t); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+	}
+
+	if out, err = hs.ss.decryptAndHash(out, message); err != nil {
+		return nil, nil, nil, err
+	}
+
+	cs1, cs2 := hs.advance()
+	return out, cs1, cs2, nil
+}
+
+// PeerStatic returns the peer's static public key once it is known.
+func (hs *HandshakeState) PeerStatic() []byte {
+	return hs.rs
+}
+
+// ChannelBinding returns the handshake hash, which uniquely identifies the
+// session once the handshake is complete.
+func (hs *HandshakeState) ChannelBinding() []byte {
+	return hs.ss.h
+}
+
+func (hs *HandshakeState) isInitiatorTurn() bool {
+	return hs.turn%2 == 0
+}
+
+func (hs *HandshakeState) mixDH(t token) error {
+	var priv *x25519.KeyPair
+	var pub []byte
+
+	switch {
+	case t == tokenEE:
+		priv, pub = hs.e, hs.re
+	case t == tokenSS:
+		priv, pub = hs.s, hs.rs
+	case (t == tokenES) == hs.initiator:
+		priv, pub = hs.e, hs.rs
+	default:
+		priv, pub = hs.s, hs.re
+	}
+	if priv == nil || len(pub) != dhLen {
+		return ErrMissingStaticKey
+	}
+
+	sharedSecret, err := curve25519.X25519(priv.PrivateKey, pub)
+	if err != nil {
+		return err
+	}
+	hs.ss.mixKey(sharedSecret)
+	return nil
+}
+
+// advance moves to the next message and returns the cipher states, oriented
+// for this party, when the handshake is finished.
+func (hs *HandshakeState) advance() (*CipherState, *CipherState) {
+	hs.turn++
+	if hs.turn < len(hs.messages) {
+		return nil, nil
+	}
+
+	c1, c2 := hs.ss.split()
+	if hs.initiator {
+		return c1, c2
+	}
+	return c2, c1
+}
+
+func generateKeypair(random io.Reader) (*x25519.KeyPair, error) {
+	privKey := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(random, privKey); err != nil {
+		return nil, err
+	}
+	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &x25519.KeyPair{PrivateKey: privKey, PublicKey: pubKey}, nil
+}
@@ -0,0 +1,374 @@
+package noise
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+type vector struct {
+	name                         string
+	prologue                     []byte
+	initStatic, respStatic       []byte
+	initEphemeral, respEphemeral []byte
+	handshakeHash                []byte
+	messages                     []vectorMessage
+	// transportByIndex is set when transport messages keep alternating by
+	// message index, as in cacophony. Otherwise the first one after the
+	// handshake is sent by the initiator.
+	transportByIndex bool
+}
+
+type vectorMessage struct {
+	payload, ciphertext []byte
+}
+
+// readFlynnVectors parses testdata/vectors.txt: blank-line separated blocks
+// of key=value lines in the format of the flynn/noise test suite.
+func readFlynnVectors(t *testing.T) []*vector {
+	f, err := os.Open("testdata/vectors.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var vectors []*vector
+	var v *vector
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			t.Fatalf("malformed line %q", line)
+		}
+
+		switch key {
+		case "handshake":
+			v = &vector{name: value}
+			vectors = append(vectors, v)
+		case "prologue":
+			v.prologue = mustHex(t, value)
+		case "init_static":
+			v.initStatic = mustHex(t, value)
+		case "resp_static":
+			v.respStatic = mustHex(t, value)
+		case "gen_init_ephemeral":
+			v.initEphemeral = mustHex(t, value)
+		case "gen_resp_ephemeral":
+			v.respEphemeral = mustHex(t, value)
+		default:
+			if !strings.HasPrefix(key, "msg_") {
+				continue
+			}
+			i, err := strconv.Atoi(strings.Split(key, "_")[1])
+			if err != nil {
+				t.Fatal(err)
+			}
+			for len(v.messages) <= i {
+				v.messages = append(v.messages, vectorMessage{})
+			}
+			if strings.HasSuffix(key, "_payload") {
+				v.messages[i].payload = mustHex(t, value)
+			} else {
+				v.messages[i].ciphertext = mustHex(t, value)
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return vectors
+}
+
+// readCacophonyVectors parses testdata/cacophony.json, which holds the
+// Noise_{XX,IK,NK}_25519_ChaChaPoly_{SHA256,BLAKE2s} entries of cacophony's
+// vectors/cacophony.txt, as shipped in the testdata of
+// github.com/katzenpost/nyquist v0.0.2.
+func readCacophonyVectors(t *testing.T) []*vector {
+	data, err := os.ReadFile("testdata/cacophony.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var file struct {
+		Vectors []struct {
+			ProtocolName     string `json:"protocol_name"`
+			InitPrologue     string `json:"init_prologue"`
+			InitStatic       string `json:"init_static"`
+			InitEphemeral    string `json:"init_ephemeral"`
+			InitRemoteStatic string `json:"init_remote_static"`
+			RespPrologue     string `json:"resp_prologue"`
+			RespStatic       string `json:"resp_static"`
+			RespEphemeral    string `json:"resp_ephemeral"`
+			HandshakeHash    string `json:"handshake_hash"`
+			Messages         []struct {
+				Payload    string `json:"payload"`
+				Ciphertext string `json:"ciphertext"`
+			} `json:"messages"`
+		} `json:"vectors"`
+	}
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatal(err)
+	}
+
+	var vectors []*vector
+	for _, cv := range file.Vectors {
+		if cv.InitPrologue != cv.RespPrologue {
+			t.Fatalf("%s: prologues differ", cv.ProtocolName)
+		}
+		v := &vector{
+			name:             cv.ProtocolName,
+			prologue:         mustHex(t, cv.InitPrologue),
+			initStatic:       mustHex(t, cv.InitStatic),
+			respStatic:       mustHex(t, cv.RespStatic),
+			initEphemeral:    mustHex(t, cv.InitEphemeral),
+			respEphemeral:    mustHex(t, cv.RespEphemeral),
+			handshakeHash:    mustHex(t, cv.HandshakeHash),
+			transportByIndex: true,
+		}
+		if cv.InitRemoteStatic != "" {
+			respPub := staticKeypair(t, v.respStatic).PublicKey
+			if !bytes.Equal(mustHex(t, cv.InitRemoteStatic), respPub) {
+				t.Fatalf("%s: init_remote_static is not the responder's key", cv.ProtocolName)
+			}
+		}
+		for _, m := range cv.Messages {
+			v.messages = append(v.messages, vectorMessage{mustHex(t, m.Payload), mustHex(t, m.Ciphertext)})
+		}
+		vectors = append(vectors, v)
+	}
+	return vectors
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func staticKeypair(t *testing.T, privKey []byte) *x25519.KeyPair {
+	t.Helper()
+	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &x25519.KeyPair{PrivateKey: privKey, PublicKey: pubKey}
+}
+
+func TestCacophonyVectors(t *testing.T) {
+	vectors := readCacophonyVectors(t)
+	if len(vectors) != 6 {
+		t.Fatalf("got %d cacophony vectors, want 6", len(vectors))
+	}
+	for _, v := range vectors {
+		v := v
+		t.Run(v.name, func(t *testing.T) { testVector(t, v) })
+	}
+}
+
+// TestFlynnVectors runs the same patterns from the flynn/noise suite, which
+// starts transport messages with the initiator after every handshake.
+func TestFlynnVectors(t *testing.T) {
+	for _, v := range readFlynnVectors(t) {
+		v := v
+		t.Run(v.name, func(t *testing.T) { testVector(t, v) })
+	}
+}
+
+func testVector(t *testing.T, v *vector) {
+	patterns := map[string]HandshakePattern{"XX": PatternXX, "IK": PatternIK, "NK": PatternNK}
+	hashes := map[string]HashFunc{"SHA256": HashSHA256, "BLAKE2s": HashBLAKE2s}
+
+	parts := strings.Split(v.name, "_")
+	if len(parts) != 5 || parts[2] != "25519" || parts[3] != "ChaChaPoly" {
+		t.Fatalf("unsupported protocol %s", v.name)
+	}
+	pattern, hash := patterns[parts[1]], hashes[parts[4]]
+
+	ci := Config{Pattern: pattern, Hash: hash, Initiator: true, Prologue: v.prologue}
+	cr := Config{Pattern: pattern, Hash: hash, Prologue: v.prologue}
+	ci.Random = bytes.NewReader(v.initEphemeral)
+	cr.Random = bytes.NewReader(v.respEphemeral)
+	if len(v.initStatic) != 0 {
+		ci.StaticKeypair = staticKeypair(t, v.initStatic)
+	}
+	if len(v.respStatic) != 0 {
+		cr.StaticKeypair = staticKeypair(t, v.respStatic)
+		if pattern.responderPreMessage {
+			ci.PeerStatic = cr.StaticKeypair.PublicKey
+		}
+	}
+
+	hsI, err := NewHandshakeState(ci)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hsR, err := NewHandshakeState(cr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := len(pattern.messages)
+	var iSend, iRecv, rSend, rRecv *CipherState
+	for i, m := range v.messages {
+		if i >= n {
+			initiatorSends := (i-n)%2 == 0
+			if v.transportByIndex {
+				initiatorSends = i%2 == 0
+			}
+			enc, dec := iSend, rRecv
+			if !initiatorSends {
+				enc, dec = rSend, iRecv
+			}
+			ct, err := enc.Encrypt(nil, nil, m.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(ct, m.ciphertext) {
+				t.Fatalf("msg %d: ciphertext = %x, want %x", i, ct, m.ciphertext)
+			}
+			pt, err := dec.Decrypt(nil, nil, ct)
+			if err != nil {
+				t.Fatalf("msg %d: %v", i, err)
+			}
+			if !bytes.Equal(pt, m.payload) {
+				t.Fatalf("msg %d: payload = %x, want %x", i, pt, m.payload)
+			}
+			continue
+		}
+
+		writer, reader := hsI, hsR
+		if i%2 != 0 {
+			writer, reader = hsR, hsI
+		}
+		msg, ws, wr, err := writer.WriteMessage(nil, m.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(msg, m.ciphertext) {
+			t.Fatalf("msg %d: handshake message = %x, want %x", i, msg, m.ciphertext)
+		}
+		pt, rs, rr, err := reader.ReadMessage(nil, msg)
+		if err != nil {
+			t.Fatalf("msg %d: %v", i, err)
+		}
+		if !bytes.Equal(pt, m.payload) {
+			t.Fatalf("msg %d: payload = %x, want %x", i, pt, m.payload)
+		}
+		if i == n-1 {
+			if writer == hsI {
+				iSend, iRecv, rSend, rRecv = ws, wr, rs, rr
+			} else {
+				rSend, rRecv, iSend, iRecv = ws, wr, rs, rr
+			}
+		}
+	}
+	if !bytes.Equal(hsI.ChannelBinding(), hsR.ChannelBinding()) {
+		t.Fatal("handshake hashes differ")
+	}
+	if v.handshakeHash != nil && !bytes.Equal(hsI.ChannelBinding(), v.handshakeHash) {
+		t.Fatalf("handshake hash = %x, want %x", hsI.ChannelBinding(), v.handshakeHash)
+	}
+}
+
+func TestVerifyPeerStatic(t *testing.T) {
+	client, server := staticKeypair(t, bytes.Repeat([]byte{1}, 32)), staticKeypair(t, bytes.Repeat([]byte{2}, 32))
+	errUnknown := errors.New("unknown key")
+
+	tests := []struct {
+		name             string
+		acceptClient     bool
+		acceptServer     bool
+		wantClientReject bool
+	}{
+		{"accepted", true, true, false},
+		{"server rejected by client", true, false, true},
+		{"client rejected by server", false, true, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			verify := func(accept bool, want []byte) func([]byte) error {
+				return func(peerStatic []byte) error {
+					if !accept || !bytes.Equal(peerStatic, want) {
+						return errUnknown
+					}
+					return nil
+				}
+			}
+
+			c1, c2 := net.Pipe()
+			cc := Client(c1, Config{Pattern: PatternXX, Hash: HashBLAKE2s, StaticKeypair: client,
+				VerifyPeerStatic: verify(tt.acceptServer, server.PublicKey)})
+			sc := Server(c2, Config{Pattern: PatternXX, Hash: HashBLAKE2s, StaticKeypair: server,
+				VerifyPeerStatic: verify(tt.acceptClient, client.PublicKey)})
+
+			done := make(chan error, 1)
+			go func() {
+				err := sc.Handshake()
+				sc.Close()
+				done <- err
+			}()
+			clientErr := cc.Handshake()
+			cc.Close()
+			serverErr := <-done
+
+			if tt.acceptClient && tt.acceptServer {
+				if clientErr != nil || serverErr != nil {
+					t.Fatalf("handshake failed: client %v, server %v", clientErr, serverErr)
+				}
+				if !bytes.Equal(cc.PeerStatic(), server.PublicKey) || !bytes.Equal(sc.PeerStatic(), client.PublicKey) {
+					t.Fatal("wrong peer static keys")
+				}
+				return
+			}
+			if tt.wantClientReject {
+				if !errors.Is(clientErr, ErrPeerStaticRejected) {
+					t.Fatalf("client error = %v, want ErrPeerStaticRejected", clientErr)
+				}
+				if serverErr == nil {
+					t.Fatal("server completed a handshake the client aborted")
+				}
+			} else if !errors.Is(serverErr, ErrPeerStaticRejected) {
+				t.Fatalf("server error = %v, want ErrPeerStaticRejected", serverErr)
+			}
+		})
+	}
+}
+
+func TestConnRoundTrip(t *testing.T) {
+	server := staticKeypair(t, bytes.Repeat([]byte{3}, 32))
+	c1, c2 := net.Pipe()
+	cc := Client(c1, Config{Pattern: PatternNK, Hash: HashSHA256, PeerStatic: server.PublicKey})
+	sc := Server(c2, Config{Pattern: PatternNK, Hash: HashSHA256, StaticKeypair: server})
+	defer cc.Close()
+	defer sc.Close()
+
+	msg := bytes.Repeat([]byte("noise"), 20000)
+	go func() {
+		cc.Write(msg)
+	}()
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(sc, got); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatal("message mismatch")
+	}
+}
@@ -0,0 +1,178 @@
+package noise
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// HashFunc selects the hash function of a Noise protocol.
+type HashFunc uint8
+
+const (
+	HashBLAKE2s HashFunc = iota
+	HashSHA256
+)
+
+func (h HashFunc) name() string {
+	switch h {
+	case HashSHA256:
+		return "SHA256"
+	default:
+		return "BLAKE2s"
+	}
+}
+
+func (h HashFunc) new() hash.Hash {
+	switch h {
+	case HashSHA256:
+		return sha256.New()
+	default:
+		hh, _ := blake2s.New256(nil)
+		return hh
+	}
+}
+
+func (h HashFunc) sum(data ...[]byte) []byte {
+	hh := h.new()
+	for _, d := range data {
+		hh.Write(d)
+	}
+	return hh.Sum(nil)
+}
+
+// hkdf is the two and three output HKDF of the Noise specification,
+// section 4.3.
+func (h HashFunc) hkdf(chainingKey, ikm []byte, outputs int) [][]byte {
+	tempMAC := hmac.New(h.new, chainingKey)
+	tempMAC.Write(ikm)
+	tempKey := tempMAC.Sum(nil)
+
+	out := make([][]byte, 0, outputs)
+	var prev []byte
+	for i := 1; i <= outputs; i++ {
+		mac := hmac.New(h.new, tempKey)
+		mac.Write(prev)
+		mac.Write([]byte{byte(i)})
+		prev = mac.Sum(nil)
+		out = append(out, prev)
+	}
+	return out
+}
+
+var (
+	ErrMessageLimit = errors.New("noise: nonce limit reached")
+	ErrDecrypt      = errors.New("noise: message authentication failed")
+)
+
+// CipherState encrypts transport messages in one direction.
+type CipherState struct {
+	aead cipher.AEAD
+	n    uint64
+}
+
+func newCipherState(key []byte) *CipherState {
+	aead, err := chacha20poly1305.New(key[:chacha20poly1305.KeySize])
+	if err != nil {
+		panic("noise: " + err.Error())
+	}
+	return &CipherState{aead: aead}
+}
+
+func (cs *CipherState) nonce() []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], cs.n)
+	return nonce
+}
+
+// Encrypt appends the encryption of plaintext with associated data ad to out.
+func (cs *CipherState) Encrypt(out, ad, plaintext []byte) ([]byte, error) {
+	if cs.aead == nil {
+		return append(out, plaintext...), nil
+	}
+	if cs.n == ^uint64(0) {
+		return nil, ErrMessageLimit
+	}
+	out = cs.aead.Seal(out, cs.nonce(), plaintext, ad)
+	cs.n++
+	return out, nil
+}
+
+// Decrypt appends the decryption of ciphertext with associated data ad to out.
+func (cs *CipherState) Decrypt(out, ad, ciphertext []byte) ([]byte, error) {
+	if cs.aead == nil {
+		return append(out, ciphertext...), nil
+	}
+	if cs.n == ^uint64(0) {
+		return nil, ErrMessageLimit
+	}
+	out, err := cs.aead.Open(out, cs.nonce(), ciphertext, ad)
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	cs.n++
+	return out, nil
+}
+
+func (cs *CipherState) hasKey() bool {
+	return cs.aead != nil
+}
+
+type symmetricState struct {
+	hash HashFunc
+	cs   CipherState
+	ck   []byte
+	h    []byte
+}
+
+func (s *symmetricState) initialize(hash HashFunc, protocolName string) {
+	s.hash = hash
+	size := hash.new().Size()
+	if len(protocolName) <= size {
+		s.h = make([]byte, size)
+		copy(s.h, protocolName)
+	} else {
+		s.h = hash.sum([]byte(protocolName))
+	}
+	s.ck = append([]byte(nil), s.h...)
+}
+
+func (s *symmetricState) mixKey(ikm []byte) {
+	out := s.hash.hkdf(s.ck, ikm, 2)
+	s.ck = out[0]
+	s.cs = *newCipherState(out[1])
+}
+
+func (s *symmetricState) mixHash(data []byte) {
+	s.h = s.hash.sum(s.h, data)
+}
+
+func (s *symmetricState) encryptAndHash(out, plaintext []byte) ([]byte, error) {
+	start := len(out)
+	out, err := s.cs.Encrypt(out, s.h, plaintext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(out[start:])
+	return out, nil
+}
+
+func (s *symmetricState) decryptAndHash(out, ciphertext []byte) ([]byte, error) {
+	out, err := s.cs.Decrypt(out, s.h, ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	s.mixHash(ciphertext)
+	return out, nil
+}
+
+func (s *symmetricState) split() (*CipherState, *CipherState) {
+	out := s.hash.hkdf(s.ck, nil, 2)
+	return newCipherState(out[0]), newCipherState(out[1])
+}
@@ -0,0 +1,253 @@
+package key25519
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/lyonnee/key25519/internal/bcryptpbkdf"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	opensshMagic   = "openssh-key-v1\x00"
+	opensshPEMType = "OPENSSH PRIVATE KEY"
+	// opensshRounds matches the ssh-keygen default for -a.
+	opensshRounds = 16
+	// opensshMaxRounds bounds the bcrypt_pbkdf rounds accepted from a file,
+	// so that a crafted key cannot stall ParseOpenSSHPrivateKey. Each round
+	// costs a few milliseconds; ssh-keygen users rarely go past a few hundred.
+	opensshMaxRounds = 1024
+)
+
+type opensshKey struct {
+	CipherName   string
+	KDFName      string
+	KDFOptions   string
+	NumKeys      uint32
+	PubKey       []byte
+	PrivKeyBlock []byte
+}
+
+type opensshKDFOptions struct {
+	Salt   []byte
+	Rounds uint32
+}
+
+type opensshPrivKeyBlock struct {
+	Check1  uint32
+	Check2  uint32
+	KeyType string
+	PubKey  []byte
+	PrivKey []byte
+	Comment string
+	Pad     []byte `ssh:"rest"`
+}
+
+type opensshPubKey struct {
+	KeyType string
+	PubKey  []byte
+}
+
+// MarshalAuthorizedKey encodes the key as an "ssh-ed25519 AAAA... comment"
+// line for an authorized_keys file, ending in a newline.
+func (pk PublicKey) MarshalAuthorizedKey(comment string) []byte {
+	line := "ssh-ed25519 " + base64.StdEncoding.EncodeToString(pk.sshWire())
+	if comment != "" {
+		line += " " + comment
+	}
+	return []byte(line + "\n")
+}
+
+func (pk PublicKey) sshWire() []byte {
+	return ssh.Marshal(opensshPubKey{ssh.KeyAlgoED25519, pk[:]})
+}
+
+// ParseAuthorizedKey parses the first key of an authorized_keys file and
+// returns it with its comment. Options before the key type are skipped.
+func ParseAuthorizedKey(line []byte) (PublicKey, string, error) {
+	key, comment, _, _, err := ssh.ParseAuthorizedKey(line)
+	if err != nil {
+		return PublicKey{}, "", err
+	}
+
+	cryptoKey, ok := key.(ssh.CryptoPublicKey)
+	if !ok {
+		return PublicKey{}, "", ErrWrongKeyType
+	}
+	edKey, ok := cryptoKey.CryptoPublicKey().(ed25519.PublicKey)
+	if !ok {
+		return PublicKey{}, "", ErrWrongKeyType
+	}
+	pubKey, err := bytesToPubKey(edKey)
+	return pubKey, comment, err
+}
+
+// MarshalOpenSSH encodes the key pair in the openssh-key-v1 format read by
+// ssh and ssh-keygen. A non-empty passphrase encrypts it with bcrypt_pbkdf
+// and aes256-ctr, as `ssh-keygen -t ed25519` does; an empty one leaves the
+// key unencrypted, like `ssh-keygen -N ""`.
+func (kp *KeyPair) MarshalOpenSSH(comment string, passphrase []byte) ([]byte, error) {
+	var check [4]byte
+	if _, err := rand.Read(check[:]); err != nil {
+		return nil, err
+	}
+	checkInt := binary.BigEndian.Uint32(check[:])
+
+	key := opensshKey{
+		CipherName: "none",
+		KDFName:    "none",
+		NumKeys:    1,
+		PubKey:     kp.pubKey.sshWire(),
+	}
+	block := opensshPrivKeyBlock{
+		Check1:  checkInt,
+		Check2:  checkInt,
+		KeyType: ssh.KeyAlgoED25519,
+		PubKey:  kp.pubKey[:],
+		PrivKey: kp.privKey[:],
+		Comment: comment,
+	}
+
+	blockSize := 8
+	var stream cipher.Stream
+	if len(passphrase) != 0 {
+		salt := make([]byte, 16)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		opts := opensshKDFOptions{salt, opensshRounds}
+
+		var err error
+		if stream, err = opensshStream("aes256-ctr", passphrase, opts); err != nil {
+			return nil, err
+		}
+		key.CipherName = "aes256-ctr"
+		key.KDFName = "bcrypt"
+		key.KDFOptions = string(ssh.Marshal(opts))
+		blockSize = aes.BlockSize
+	}
+
+	n := len(ssh.Marshal(block)) % blockSize
+	if n != 0 {
+		for i := 1; i <= blockSize-n; i++ {
+			block.Pad = append(block.Pad, byte(i))
+		}
+	}
+	key.PrivKeyBlock = ssh.Marshal(block)
+	if stream != nil {
+		stream.XORKeyStream(key.PrivKeyBlock, key.PrivKeyBlock)
+	}
+
+	data := append([]byte(opensshMagic), ssh.Marshal(key)...)
+	return pem.EncodeToMemory(&pem.Block{Type: opensshPEMType, Bytes: data}), nil
+}
+
+// ParseOpenSSHPrivateKey parses an "OPENSSH PRIVATE KEY" PEM block holding an
+// Ed25519 key, decrypting it with passphrase if needed, and returns the key
+// pair with its comment. An empty passphrase is treated like a nil one.
+func ParseOpenSSHPrivateKey(data, passphrase []byte) (*KeyPair, string, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != opensshPEMType {
+		return nil, "", fmt.Errorf("key25519: no %s PEM block found", opensshPEMType)
+	}
+	if !bytes.HasPrefix(block.Bytes, []byte(opensshMagic)) {
+		return nil, "", errors.New("key25519: invalid openssh-key-v1 magic")
+	}
+
+	var key opensshKey
+	if err := ssh.Unmarshal(block.Bytes[len(opensshMagic):], &key); err != nil {
+		return nil, "", err
+	}
+	if key.NumKeys != 1 {
+		return nil, "", fmt.Errorf("key25519: expected one key in file, got %d", key.NumKeys)
+	}
+
+	privBlock := key.PrivKeyBlock
+	if key.CipherName != "none" || key.KDFName != "none" {
+		if key.KDFName != "bcrypt" {
+			return nil, "", fmt.Errorf("key25519: unsupported OpenSSH KDF: %s", key.KDFName)
+		}
+		if len(passphrase) == 0 {
+			return nil, "", ErrPassphraseRequired
+		}
+
+		var opts opensshKDFOptions
+		if err := ssh.Unmarshal([]byte(key.KDFOptions), &opts); err != nil {
+			return nil, "", err
+		}
+		if opts.Rounds > opensshMaxRounds {
+			return nil, "", fmt.Errorf("key25519: too many bcrypt_pbkdf rounds: %d", opts.Rounds)
+		}
+		stream, err := opensshStream(key.CipherName, passphrase, opts)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(privBlock)%aes.BlockSize != 0 {
+			return nil, "", errors.New("key25519: invalid OpenSSH private key length")
+		}
+		privBlock = bytes.Clone(privBlock)
+		stream.XORKeyStream(privBlock, privBlock)
+	}
+
+	var pk opensshPrivKeyBlock
+	if len(privBlock) < 8 || subtle.ConstantTimeCompare(privBlock[:4], privBlock[4:8]) != 1 {
+		if key.CipherName != "none" {
+			return nil, "", ErrIncorrectPassphrase
+		}
+		return nil, "", errors.New("key25519: OpenSSH check bytes do not match")
+	}
+	if err := ssh.Unmarshal(privBlock, &pk); err != nil {
+		return nil, "", err
+	}
+	if pk.KeyType != ssh.KeyAlgoED25519 {
+		return nil, "", ErrWrongKeyType
+	}
+	for i, b := range pk.Pad {
+		if int(b) != i+1 {
+			return nil, "", errors.New("key25519: invalid OpenSSH padding")
+		}
+	}
+
+	privKey, err := bytesToPrivKey(pk.PrivKey)
+	if err != nil {
+		return nil, "", err
+	}
+	if !bytes.Equal(pk.PubKey, privKey[32:]) {
+		return nil, "", ErrKeyMismatch
+	}
+	return &KeyPair{privKey: privKey, pubKey: privKey.GetPubKey()}, pk.Comment, nil
+}
+
+// opensshStream derives the AES-CTR key and IV of an encrypted private key.
+func opensshStream(cipherName string, passphrase []byte, opts opensshKDFOptions) (cipher.Stream, error) {
+	var keyLen int
+	switch cipherName {
+	case "aes128-ctr":
+		keyLen = 16
+	case "aes192-ctr":
+		keyLen = 24
+	case "aes256-ctr":
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("key25519: unsupported OpenSSH cipher: %s", cipherName)
+	}
+
+	k, err := bcryptpbkdf.Key(passphrase, opts.Salt, int(opts.Rounds), keyLen+aes.BlockSize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(k[:keyLen])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewCTR(block, k[keyLen:]), nil
+}
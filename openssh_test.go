@@ -0,0 +1,135 @@
+package key25519
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+const sshPassphrase = "correct horse"
+
+// The fixtures in testdata were written by ssh-keygen (OpenSSH 9):
+//
+//	ssh-keygen -t ed25519 -N "" -C plain@key25519 -f id_ed25519
+//	ssh-keygen -t ed25519 -N "correct horse" -C encrypted@key25519 -f id_ed25519_enc
+func TestParseOpenSSHReference(t *testing.T) {
+	tests := []struct {
+		file, comment, passphrase string
+	}{
+		{"id_ed25519", "plain@key25519", ""},
+		{"id_ed25519_enc", "encrypted@key25519", sshPassphrase},
+	}
+	for _, tt := range tests {
+		data := readTestdata(t, tt.file)
+		pub, comment, err := ParseAuthorizedKey(readTestdata(t, tt.file+".pub"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if comment != tt.comment {
+			t.Errorf("%s.pub: comment = %q, want %q", tt.file, comment, tt.comment)
+		}
+
+		kp, comment, err := ParseOpenSSHPrivateKey(data, []byte(tt.passphrase))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.file, err)
+		}
+		if comment != tt.comment {
+			t.Errorf("%s: comment = %q, want %q", tt.file, comment, tt.comment)
+		}
+		if kp.PublicKey() != pub {
+			t.Errorf("%s: public key does not match %s.pub", tt.file, tt.file)
+		}
+	}
+}
+
+func TestParseOpenSSHPassphrase(t *testing.T) {
+	data := readTestdata(t, "id_ed25519_enc")
+	for _, passphrase := range [][]byte{nil, {}} {
+		if _, _, err := ParseOpenSSHPrivateKey(data, passphrase); !errors.Is(err, ErrPassphraseRequired) {
+			t.Errorf("passphrase %q: got %v, want ErrPassphraseRequired", passphrase, err)
+		}
+	}
+	if _, _, err := ParseOpenSSHPrivateKey(data, []byte("wrong")); !errors.Is(err, ErrIncorrectPassphrase) {
+		t.Errorf("got %v, want ErrIncorrectPassphrase", err)
+	}
+}
+
+func TestMarshalOpenSSHRoundTrip(t *testing.T) {
+	kp := NewKeyPair()
+	for _, passphrase := range []string{"", sshPassphrase} {
+		data, err := kp.MarshalOpenSSH("round@trip", []byte(passphrase))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, comment, err := ParseOpenSSHPrivateKey(data, []byte(passphrase))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.PrivateKey() != kp.PrivateKey() || comment != "round@trip" {
+			t.Errorf("passphrase %q: key pair did not round-trip", passphrase)
+		}
+
+		// x/crypto/ssh must read what we write.
+		var raw any
+		if passphrase == "" {
+			raw, err = ssh.ParseRawPrivateKey(data)
+		} else {
+			raw, err = ssh.ParseRawPrivateKeyWithPassphrase(data, []byte(passphrase))
+		}
+		if err != nil {
+			t.Fatalf("passphrase %q: x/crypto/ssh: %v", passphrase, err)
+		}
+		edKey, ok := raw.(*ed25519.PrivateKey)
+		if !ok || !bytes.Equal(*edKey, kp.PrivateKey().ToEd25519PrivKey()) {
+			t.Errorf("passphrase %q: x/crypto/ssh parsed a different key", passphrase)
+		}
+	}
+}
+
+func TestMarshalOpenSSHEmptyPassphrase(t *testing.T) {
+	data, err := NewKeyPair().MarshalOpenSSH("", []byte{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ParseOpenSSHPrivateKey(data, nil); err != nil {
+		t.Fatalf("empty passphrase produced an encrypted key: %v", err)
+	}
+}
+
+func TestParseOpenSSHRoundsLimit(t *testing.T) {
+	data, err := NewKeyPair().MarshalOpenSSH("", []byte(sshPassphrase))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	var key opensshKey
+	if err := ssh.Unmarshal(block.Bytes[len(opensshMagic):], &key); err != nil {
+		t.Fatal(err)
+	}
+	var opts opensshKDFOptions
+	if err := ssh.Unmarshal([]byte(key.KDFOptions), &opts); err != nil {
+		t.Fatal(err)
+	}
+	opts.Rounds = 1 << 31
+	key.KDFOptions = string(ssh.Marshal(opts))
+	block.Bytes = append([]byte(opensshMagic), ssh.Marshal(key)...)
+
+	if _, _, err := ParseOpenSSHPrivateKey(pem.EncodeToMemory(block), []byte(sshPassphrase)); err == nil {
+		t.Fatal("accepted a key with 2^31 bcrypt_pbkdf rounds")
+	}
+}
+
+func readTestdata(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,113 @@
+package key25519
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+
+	"github.com/lyonnee/key25519/pkcs8"
+)
+
+const pemPublicKeyType = "PUBLIC KEY"
+
+// MarshalPKCS8 encodes the key as an unencrypted PKCS#8 PrivateKeyInfo
+// (RFC 8410), as written by `openssl genpkey -algorithm ed25519`.
+func (pk PrivateKey) MarshalPKCS8() ([]byte, error) {
+	return x509.MarshalPKCS8PrivateKey(pk.ToEd25519PrivKey())
+}
+
+// MarshalEncryptedPKCS8 encodes the key as a PBES2-encrypted PKCS#8
+// EncryptedPrivateKeyInfo.
+func (pk PrivateKey) MarshalEncryptedPKCS8(password []byte, opts *pkcs8.Options) ([]byte, error) {
+	der, err := pk.MarshalPKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return pkcs8.Encrypt(der, password, opts)
+}
+
+// MarshalPEM encodes the key as a PKCS#8 PEM block, encrypted under password
+// unless password is nil.
+func (pk PrivateKey) MarshalPEM(password []byte, opts *pkcs8.Options) ([]byte, error) {
+	der, err := pk.MarshalPKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return pkcs8.EncodePEM(der, password, opts)
+}
+
+// MarshalPKIX encodes the key as a PKIX SubjectPublicKeyInfo.
+func (pk PublicKey) MarshalPKIX() ([]byte, error) {
+	return x509.MarshalPKIXPublicKey(pk.ToEd25519PubKey())
+}
+
+// MarshalPEM encodes the key as a "PUBLIC KEY" PEM block.
+func (pk PublicKey) MarshalPEM() ([]byte, error) {
+	der, err := pk.MarshalPKIX()
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPublicKeyType, Bytes: der}), nil
+}
+
+// ParsePKCS8PrivateKey parses an unencrypted PKCS#8 Ed25519 private key.
+func ParsePKCS8PrivateKey(der []byte) (PrivateKey, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+
+	edKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return PrivateKey{}, ErrWrongKeyType
+	}
+	return bytesToPrivKey(edKey)
+}
+
+// ParseEncryptedPKCS8PrivateKey decrypts and parses a PBES2-encrypted PKCS#8
+// Ed25519 private key.
+func ParseEncryptedPKCS8PrivateKey(der, password []byte) (PrivateKey, error) {
+	plain, err := pkcs8.Decrypt(der, password)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return ParsePKCS8PrivateKey(plain)
+}
+
+// ParsePrivateKeyPEM parses the first "PRIVATE KEY" or "ENCRYPTED PRIVATE
+// KEY" block in data. password is only used for encrypted keys.
+func ParsePrivateKeyPEM(data, password []byte) (PrivateKey, error) {
+	der, err := pkcs8.DecodePEM(data, password)
+	if err != nil {
+		return PrivateKey{}, err
+	}
+	return ParsePKCS8PrivateKey(der)
+}
+
+// ParsePKIXPublicKey parses a PKIX SubjectPublicKeyInfo Ed25519 public key.
+func ParsePKIXPublicKey(der []byte) (PublicKey, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return PublicKey{}, err
+	}
+
+	edKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return PublicKey{}, ErrWrongKeyType
+	}
+	return bytesToPubKey(edKey)
+}
+
+// ParsePublicKeyPEM parses the first "PUBLIC KEY" block in data.
+func ParsePublicKeyPEM(data []byte) (PublicKey, error) {
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return PublicKey{}, ErrNoPEMBlock
+		}
+		if block.Type == pemPublicKeyType {
+			return ParsePKIXPublicKey(block.Bytes)
+		}
+		data = rest
+	}
+}
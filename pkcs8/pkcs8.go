@@ -0,0 +1,363 @@
+// Package pkcs8 encrypts and decrypts PKCS#8 private keys with PBES2
+// (RFC 8018), using scrypt (RFC 7914) or PBKDF2 to derive an AES-CBC key.
+// The output is what `openssl pkcs8 -topk8 -v2 aes-256-cbc` produces and is
+// read by OpenSSL, Go's x/crypto and most other tooling.
+package pkcs8
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+// PEM block types of plain and encrypted PKCS#8 private keys.
+const (
+	PEMType          = "PRIVATE KEY"
+	EncryptedPEMType = "ENCRYPTED PRIVATE KEY"
+)
+
+var (
+	ErrDecrypt          = errors.New("pkcs8: decryption failed, wrong password?")
+	ErrPasswordRequired = errors.New("pkcs8: private key is encrypted")
+	ErrNoPEMBlock       = errors.New("pkcs8: no private key PEM block found")
+	ErrKDFLimits        = errors.New("pkcs8: KDF parameters exceed limits")
+)
+
+// Upper bounds on the KDF parameters Decrypt accepts, so that a crafted file
+// cannot make it allocate gigabytes or spin for hours. They are well above
+// what OpenSSL and this package produce; Encrypt enforces them too.
+const (
+	maxScryptN          = 1 << 20
+	maxScryptR          = 32
+	maxScryptP          = 16
+	maxScryptMemory     = 1 << 30 // 128 * N * r bytes
+	maxPBKDF2Iterations = 10000000
+)
+
+// KDF selects the PBES2 key derivation function.
+type KDF int
+
+const (
+	KDFScrypt KDF = iota
+	KDFPBKDF2
+)
+
+// Options configures Encrypt. A nil *Options selects scrypt with the
+// defaults below. Parameters beyond what Decrypt accepts (scrypt N up to
+// 2^20 with at most 1 GiB of memory, r up to 32, p up to 16, and up to 10
+// million PBKDF2 iterations) fail with ErrKDFLimits.
+type Options struct {
+	KDF KDF
+
+	// scrypt cost parameters; zero values default to N=16384, r=8, p=1,
+	// the same as OpenSSL.
+	ScryptN, ScryptR, ScryptP int
+
+	// PBKDF2 iteration count with HMAC-SHA256; zero defaults to 600000.
+	PBKDF2Iterations int
+
+	// Rand supplies the salt and IV; nil uses crypto/rand.
+	Rand io.Reader
+}
+
+var (
+	oidPBES2  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2 = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+
+	oidAES128CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// Encrypt wraps the DER of a PrivateKeyInfo into an EncryptedPrivateKeyInfo
+// under password, using PBES2 with AES-256-CBC.
+func Encrypt(der, password []byte, opts *Options) ([]byte, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	r := opts.Rand
+	if r == nil {
+		r = rand.Reader
+	}
+
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(r, salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(r, iv); err != nil {
+		return nil, err
+	}
+
+	const keyLen = 32
+	var (
+		kdf pkix.AlgorithmIdentifier
+		key []byte
+		err error
+	)
+	switch opts.KDF {
+	case KDFScrypt:
+		n, rr, p := orDefault(opts.ScryptN, 1<<14), orDefault(opts.ScryptR, 8), orDefault(opts.ScryptP, 1)
+		if err := checkScrypt(n, rr, p); err != nil {
+			return nil, err
+		}
+		if key, err = scrypt.Key(password, salt, n, rr, p, keyLen); err != nil {
+			return nil, err
+		}
+		kdf.Algorithm = oidScrypt
+		kdf.Parameters.FullBytes, err = asn1.Marshal(scryptParams{salt, n, rr, p, keyLen})
+	case KDFPBKDF2:
+		iter := orDefault(opts.PBKDF2Iterations, 600000)
+		if err := checkPBKDF2(iter); err != nil {
+			return nil, err
+		}
+		key = pbkdf2.Key(password, salt, iter, keyLen, sha256.New)
+		kdf.Algorithm = oidPBKDF2
+		kdf.Parameters.FullBytes, err = asn1.Marshal(pbkdf2Params{
+			Salt:           salt,
+			IterationCount: iter,
+			PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+		})
+	default:
+		return nil, fmt.Errorf("pkcs8: unsupported KDF: %d", opts.KDF)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padLen := aes.BlockSize - len(der)%aes.BlockSize
+	data := append(bytes.Clone(der), bytes.Repeat([]byte{byte(padLen)}, padLen)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+	var scheme pkix.AlgorithmIdentifier
+	scheme.Algorithm = oidAES256CBC
+	if scheme.Parameters.FullBytes, err = asn1.Marshal(iv); err != nil {
+		return nil, err
+	}
+
+	var info encryptedPrivateKeyInfo
+	info.Algorithm.Algorithm = oidPBES2
+	if info.Algorithm.Parameters.FullBytes, err = asn1.Marshal(pbes2Params{kdf, scheme}); err != nil {
+		return nil, err
+	}
+	info.EncryptedData = data
+
+	return asn1.Marshal(info)
+}
+
+// Decrypt unwraps an EncryptedPrivateKeyInfo and returns the DER of the
+// PrivateKeyInfo inside. PBES2 with scrypt, or PBKDF2 over HMAC-SHA1/256/512,
+// and AES-128/192/256-CBC are supported.
+func Decrypt(der, password []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	} else if len(rest) > 0 {
+		return nil, errors.New("pkcs8: trailing data after EncryptedPrivateKeyInfo")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("pkcs8: unsupported encryption algorithm: %v", info.Algorithm.Algorithm)
+	}
+
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, err
+	}
+
+	var keyLen int
+	switch alg := params.EncryptionScheme.Algorithm; {
+	case alg.Equal(oidAES128CBC):
+		keyLen = 16
+	case alg.Equal(oidAES192CBC):
+		keyLen = 24
+	case alg.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("pkcs8: unsupported cipher: %v", alg)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("pkcs8: invalid IV length")
+	}
+
+	key, err := deriveKey(params.KeyDerivationFunc, password, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	data := info.EncryptedData
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("pkcs8: invalid ciphertext length")
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+	padLen := int(plain[len(plain)-1])
+	if padLen == 0 || padLen > aes.BlockSize {
+		return nil, ErrDecrypt
+	}
+	for _, b := range plain[len(plain)-padLen:] {
+		if int(b) != padLen {
+			return nil, ErrDecrypt
+		}
+	}
+	return plain[:len(plain)-padLen], nil
+}
+
+func deriveKey(kdf pkix.AlgorithmIdentifier, password []byte, keyLen int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidScrypt):
+		var p scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, err
+		}
+		if p.KeyLength != 0 && p.KeyLength != keyLen {
+			return nil, errors.New("pkcs8: KDF key length does not match cipher")
+		}
+		if err := checkScrypt(p.CostParameter, p.BlockSize, p.ParallelizationParameter); err != nil {
+			return nil, err
+		}
+		return scrypt.Key(password, p.Salt, p.CostParameter, p.BlockSize, p.ParallelizationParameter, keyLen)
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var p pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &p); err != nil {
+			return nil, err
+		}
+		if p.KeyLength != 0 && p.KeyLength != keyLen {
+			return nil, errors.New("pkcs8: KDF key length does not match cipher")
+		}
+		if err := checkPBKDF2(p.IterationCount); err != nil {
+			return nil, err
+		}
+		var h func() hash.Hash
+		switch prf := p.PRF.Algorithm; {
+		case len(prf) == 0, prf.Equal(oidHMACWithSHA1):
+			h = sha1.New
+		case prf.Equal(oidHMACWithSHA256):
+			h = sha256.New
+		case prf.Equal(oidHMACWithSHA512):
+			h = sha512.New
+		default:
+			return nil, fmt.Errorf("pkcs8: unsupported PBKDF2 PRF: %v", prf)
+		}
+		return pbkdf2.Key(password, p.Salt, p.IterationCount, keyLen, h), nil
+	}
+	return nil, fmt.Errorf("pkcs8: unsupported KDF: %v", kdf.Algorithm)
+}
+
+func checkScrypt(n, r, p int) error {
+	if n <= 1 || n&(n-1) != 0 || r <= 0 || p <= 0 {
+		return errors.New("pkcs8: invalid scrypt parameters")
+	}
+	if n > maxScryptN || r > maxScryptR || p > maxScryptP || 128*n*r > maxScryptMemory {
+		return fmt.Errorf("%w: scrypt N=%d r=%d p=%d", ErrKDFLimits, n, r, p)
+	}
+	return nil
+}
+
+func checkPBKDF2(iter int) error {
+	if iter <= 0 {
+		return errors.New("pkcs8: invalid PBKDF2 iteration count")
+	}
+	if iter > maxPBKDF2Iterations {
+		return fmt.Errorf("%w: PBKDF2 iterations=%d", ErrKDFLimits, iter)
+	}
+	return nil
+}
+
+// EncodePEM wraps the DER of a PrivateKeyInfo in a PEM block, encrypting it
+// with Encrypt first if password is non-nil.
+func EncodePEM(der, password []byte, opts *Options) ([]byte, error) {
+	if password == nil {
+		return pem.EncodeToMemory(&pem.Block{Type: PEMType, Bytes: der}), nil
+	}
+
+	enc, err := Encrypt(der, password, opts)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: EncryptedPEMType, Bytes: enc}), nil
+}
+
+// DecodePEM returns the PrivateKeyInfo DER of the first private key PEM
+// block in data, decrypting it with password if it is encrypted.
+func DecodePEM(data, password []byte) ([]byte, error) {
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return nil, ErrNoPEMBlock
+		}
+		switch block.Type {
+		case PEMType:
+			return block.Bytes, nil
+		case EncryptedPEMType:
+			if password == nil {
+				return nil, ErrPasswordRequired
+			}
+			return Decrypt(block.Bytes, password)
+		}
+		data = rest
+	}
+}
+
+func orDefault(v, def int) int {
+	if v == 0 {
+		return def
+	}
+	return v
+}
@@ -0,0 +1,136 @@
+package pkcs8
+
+import (
+	"bytes"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"os"
+	"testing"
+)
+
+const testPassword = "correct horse"
+
+func readPEM(t *testing.T, name string) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// TestOpenSSLFiles decrypts keys written by
+// `openssl pkcs8 -topk8 -v2 aes-256-cbc -scrypt` and
+// `openssl pkcs8 -topk8 -v2 aes-128-cbc -v2prf hmacWithSHA512 -iter 2048`.
+func TestOpenSSLFiles(t *testing.T) {
+	want, err := DecodePEM(readPEM(t, "plain.pem"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"scrypt.pem", "pbkdf2.pem"} {
+		data := readPEM(t, name)
+		if _, err := DecodePEM(data, nil); err != ErrPasswordRequired {
+			t.Errorf("%s: DecodePEM without password = %v, want ErrPasswordRequired", name, err)
+		}
+		if _, err := DecodePEM(data, []byte("wrong")); err == nil {
+			t.Errorf("%s: wrong password accepted", name)
+		}
+		got, err := DecodePEM(data, []byte(testPassword))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: decrypted key does not match plain.pem", name)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	der := bytes.Repeat([]byte{0x30}, 48)
+	for _, opts := range []*Options{
+		nil,
+		{KDF: KDFScrypt, ScryptN: 1 << 10},
+		{KDF: KDFPBKDF2, PBKDF2Iterations: 1000},
+	} {
+		data, err := EncodePEM(der, []byte(testPassword), opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DecodePEM(data, []byte(testPassword))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, der) {
+			t.Fatal("round trip mismatch")
+		}
+	}
+}
+
+// encryptedWith replaces the KDF parameters of an encrypted key.
+func encryptedWith(t *testing.T, kdf asn1.ObjectIdentifier, params any) []byte {
+	t.Helper()
+	block, _ := pem.Decode(readPEM(t, "scrypt.pem"))
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		t.Fatal(err)
+	}
+	var pbes2 pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &pbes2); err != nil {
+		t.Fatal(err)
+	}
+
+	var err error
+	pbes2.KeyDerivationFunc = pkix.AlgorithmIdentifier{Algorithm: kdf}
+	if pbes2.KeyDerivationFunc.Parameters.FullBytes, err = asn1.Marshal(params); err != nil {
+		t.Fatal(err)
+	}
+	if info.Algorithm.Parameters.FullBytes, err = asn1.Marshal(pbes2); err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestDecryptKDFLimits(t *testing.T) {
+	salt := make([]byte, 16)
+	tests := []struct {
+		name   string
+		kdf    asn1.ObjectIdentifier
+		params any
+		limits bool
+	}{
+		{"scrypt N", oidScrypt, scryptParams{salt, 1 << 21, 8, 1, 0}, true},
+		{"scrypt r", oidScrypt, scryptParams{salt, 1 << 10, 64, 1, 0}, true},
+		{"scrypt p", oidScrypt, scryptParams{salt, 1 << 10, 8, 1 << 20, 0}, true},
+		{"scrypt memory", oidScrypt, scryptParams{salt, 1 << 20, 16, 1, 0}, true},
+		{"scrypt N not a power of two", oidScrypt, scryptParams{salt, 1000, 8, 1, 0}, false},
+		{"scrypt r zero", oidScrypt, scryptParams{salt, 1 << 10, 0, 1, 0}, false},
+		{"pbkdf2 iterations", oidPBKDF2, pbkdf2Params{Salt: salt, IterationCount: 1 << 30}, true},
+		{"pbkdf2 zero iterations", oidPBKDF2, pbkdf2Params{Salt: salt}, false},
+	}
+	for _, tt := range tests {
+		_, err := Decrypt(encryptedWith(t, tt.kdf, tt.params), []byte(testPassword))
+		if err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		} else if errors.Is(err, ErrKDFLimits) != tt.limits {
+			t.Errorf("%s: got %v, ErrKDFLimits expected: %v", tt.name, err, tt.limits)
+		}
+	}
+}
+
+func TestEncryptKDFLimits(t *testing.T) {
+	for _, opts := range []*Options{
+		{KDF: KDFScrypt, ScryptN: 1 << 21},
+		{KDF: KDFScrypt, ScryptP: 17},
+		{KDF: KDFPBKDF2, PBKDF2Iterations: maxPBKDF2Iterations + 1},
+	} {
+		if _, err := Encrypt([]byte{0x30, 0}, []byte(testPassword), opts); !errors.Is(err, ErrKDFLimits) {
+			t.Errorf("%+v: got %v, want ErrKDFLimits", opts, err)
+		}
+	}
+}
@@ -1,9 +1,14 @@
 package key25519
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ed25519"
 	"crypto/rand"
+	"crypto/sha512"
 	"encoding/hex"
+	"fmt"
+	"io"
 )
 
 const PrivateKeyLength int = ed25519.PrivateKeySize
@@ -31,20 +36,69 @@ func (pk PrivateKey) SignMsg(msg []byte) []byte {
 	return ed25519.Sign(pk.ToEd25519PrivKey(), msg)
 }
 
+// SignMsgPh signs msg with Ed25519ph (RFC 8032): the message is pre-hashed
+// with SHA-512 before signing. context may be empty.
+func (pk PrivateKey) SignMsgPh(msg []byte, context string) ([]byte, error) {
+	digest := sha512.Sum512(msg)
+	return pk.signDigest(digest[:], context)
+}
+
+// SignMsgCtx signs msg with Ed25519ctx (RFC 8032) under a non-empty
+// domain-separation context of at most 255 bytes.
+func (pk PrivateKey) SignMsgCtx(msg []byte, context string) ([]byte, error) {
+	if context == "" {
+		return nil, errEmptyContext
+	}
+	return pk.ToEd25519PrivKey().Sign(nil, msg, &ed25519.Options{Context: context})
+}
+
+func (pk PrivateKey) signDigest(digest []byte, context string) ([]byte, error) {
+	return pk.ToEd25519PrivKey().Sign(nil, digest, &ed25519.Options{Hash: crypto.SHA512, Context: context})
+}
+
 func (pk PrivateKey) HexString() string {
 	return hex.EncodeToString(pk.Bytes())
 }
 
+// NewPrivateKey builds a private key from seed, or from crypto/rand if seed
+// is nil.
+//
+// Deprecated: it panics on a malformed seed or an entropy failure. Use
+// NewPrivateKeyFromSeed or GeneratePrivateKey instead.
 func NewPrivateKey(seed []byte) PrivateKey {
+	var privKey PrivateKey
+	var err error
 	if seed == nil {
-		seed = randSeed()
+		privKey, err = GeneratePrivateKey(rand.Reader)
+	} else {
+		privKey, err = NewPrivateKeyFromSeed(seed)
+	}
+	if err != nil {
+		panic(err)
 	}
-	edPrivKey := ed25519.NewKeyFromSeed(seed)
-
-	privKey, _ := bytesToPrivKey(edPrivKey)
 	return privKey
 }
 
+// NewPrivateKeyFromSeed derives the private key of a 32-byte Ed25519 seed.
+func NewPrivateKeyFromSeed(seed []byte) (PrivateKey, error) {
+	if len(seed) != ed25519.SeedSize {
+		return PrivateKey{}, ErrInvalidLength
+	}
+
+	return bytesToPrivKey(ed25519.NewKeyFromSeed(seed))
+}
+
+// GeneratePrivateKey reads a seed from rand and derives its private key.
+// Errors from rand are returned rather than ignored.
+func GeneratePrivateKey(rand io.Reader) (PrivateKey, error) {
+	seed := make([]byte, ed25519.SeedSize)
+	if _, err := io.ReadFull(rand, seed); err != nil {
+		return PrivateKey{}, fmt.Errorf("reading seed failed: %w", err)
+	}
+
+	return NewPrivateKeyFromSeed(seed)
+}
+
 func NewPrivKeyFromEd25119PrivKey(key ed25519.PrivateKey) (PrivateKey, error) {
 	return bytesToPrivKey(key)
 }
@@ -78,13 +132,16 @@ func (pk PrivateKey) Seed() []byte {
 
 func bytesToPrivKey(d []byte) (PrivateKey, error) {
 	var privKey PrivateKey
-	copy(privKey[:], d)
-	return privKey, nil
-}
+	if len(d) != PrivateKeyLength {
+		return privKey, ErrInvalidLength
+	}
 
-func randSeed() []byte {
-	seed := make([]byte, 32)
-	rand.Read(seed)
+	// 私钥后32字节必须是由前32字节种子推导出的公钥
+	edPrivKey := ed25519.NewKeyFromSeed(d[:ed25519.SeedSize])
+	if !bytes.Equal(edPrivKey[ed25519.SeedSize:], d[ed25519.SeedSize:]) {
+		return privKey, ErrKeyMismatch
+	}
 
-	return seed
+	copy(privKey[:], d)
+	return privKey, nil
 }
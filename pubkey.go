@@ -1,8 +1,13 @@
 package key25519
 
 import (
+	"bytes"
+	"crypto"
 	"crypto/ed25519"
+	"crypto/sha512"
 	"encoding/hex"
+
+	"filippo.io/edwards25519"
 )
 
 const PublicKeyLength int = ed25519.PublicKeySize
@@ -21,10 +26,40 @@ func (pk PublicKey) VerifyMsg(originMsg, signMsg []byte) bool {
 	return ed25519.Verify(pk[:], originMsg, signMsg)
 }
 
+// VerifyMsgPh verifies an Ed25519ph signature of msg made with SignMsgPh.
+func (pk PublicKey) VerifyMsgPh(msg, signMsg []byte, context string) bool {
+	digest := sha512.Sum512(msg)
+	return pk.verifyDigest(digest[:], signMsg, context)
+}
+
+// VerifyMsgCtx verifies an Ed25519ctx signature of msg made with SignMsgCtx.
+func (pk PublicKey) VerifyMsgCtx(msg, signMsg []byte, context string) bool {
+	if context == "" {
+		return false
+	}
+	return ed25519.VerifyWithOptions(pk[:], msg, signMsg, &ed25519.Options{Context: context}) == nil
+}
+
+func (pk PublicKey) verifyDigest(digest, signMsg []byte, context string) bool {
+	return ed25519.VerifyWithOptions(pk[:], digest, signMsg, &ed25519.Options{Hash: crypto.SHA512, Context: context}) == nil
+}
+
 func (pk PublicKey) Bytes() []byte {
 	return pk[:]
 }
 
+// ToX25519 maps the Ed25519 public key to its X25519 (Montgomery u) form
+// using u = (1 + y) / (1 - y). Non-canonical encodings and small-order
+// points are rejected, so the result is safe to use as an ECDH peer key.
+func (pk PublicKey) ToX25519() ([]byte, error) {
+	p, err := pk.point()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.BytesMontgomery(), nil
+}
+
 func (pk *PublicKey) LoadFromBytes(d []byte) error {
 	bpk, err := bytesToPubKey(d)
 	if err != nil {
@@ -36,8 +71,45 @@ func (pk *PublicKey) LoadFromBytes(d []byte) error {
 	return err
 }
 
+// point decodes the public key, accepting only canonical encodings of
+// points outside the small-order subgroup.
+func (pk PublicKey) point() (*edwards25519.Point, error) {
+	p, err := pk.decode()
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(p.Bytes(), pk[:]) {
+		return nil, ErrNonCanonical
+	}
+
+	return p, nil
+}
+
+// decode decodes the public key and rejects small-order points. Non-canonical
+// encodings are accepted, as ZIP-215 requires.
+func (pk PublicKey) decode() (*edwards25519.Point, error) {
+	p, err := new(edwards25519.Point).SetBytes(pk[:])
+	if err != nil {
+		return nil, ErrInvalidPoint
+	}
+
+	if new(edwards25519.Point).MultByCofactor(p).Equal(edwards25519.NewIdentityPoint()) == 1 {
+		return nil, ErrSmallOrder
+	}
+
+	return p, nil
+}
+
 func bytesToPubKey(d []byte) (PublicKey, error) {
 	var pubKey PublicKey
+	if len(d) != PublicKeyLength {
+		return pubKey, ErrInvalidLength
+	}
 	copy(pubKey[:], d)
+
+	if _, err := pubKey.decode(); err != nil {
+		return PublicKey{}, err
+	}
 	return pubKey, nil
 }
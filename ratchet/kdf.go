@@ -0,0 +1,89 @@
+package ratchet
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"io"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+const keySize = 32
+
+// kdfRK derives a new root key and chain key, plus a next header key when
+// header encryption is on, from the root key and a DH output.
+func (s *Session) kdfRK(rk, dhOut []byte) (newRK, ck, nhk []byte, err error) {
+	n := 2 * keySize
+	if s.st.HeaderEncryption {
+		n += keySize
+	}
+
+	out := make([]byte, n)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, dhOut, rk, s.info("Root")), out); err != nil {
+		return nil, nil, nil, err
+	}
+	newRK, ck = out[:keySize], out[keySize:2*keySize]
+	if s.st.HeaderEncryption {
+		nhk = out[2*keySize:]
+	}
+	return newRK, ck, nhk, nil
+}
+
+// headerKeys derives the initial shared header keys from the shared secret
+// when header encryption is on; the sender header key of the initiator and
+// the next header key of the responder.
+func (s *Session) headerKeys(sharedSecret []byte) (hka, nhkb []byte, err error) {
+	out := make([]byte, 2*keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, sharedSecret, nil, s.info("HeaderKeys")), out); err != nil {
+		return nil, nil, err
+	}
+	return out[:keySize], out[keySize:], nil
+}
+
+// kdfCK advances a chain key, returning the next chain key and a message key.
+func kdfCK(ck []byte) (nextCK, mk []byte) {
+	h := hmac.New(sha256.New, ck)
+	h.Write([]byte{0x01})
+	mk = h.Sum(nil)
+
+	h = hmac.New(sha256.New, ck)
+	h.Write([]byte{0x02})
+	nextCK = h.Sum(nil)
+	return nextCK, mk
+}
+
+// messageCipher expands a single-use message key into a ChaCha20-Poly1305
+// key and nonce.
+func (s *Session) messageCipher(mk []byte) (key, nonce []byte, err error) {
+	out := make([]byte, chacha20poly1305.KeySize+chacha20poly1305.NonceSize)
+	salt := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, mk, salt, s.info("MessageKeys")), out); err != nil {
+		return nil, nil, err
+	}
+	return out[:chacha20poly1305.KeySize], out[chacha20poly1305.KeySize:], nil
+}
+
+func (s *Session) info(label string) []byte {
+	return append(append([]byte(nil), s.st.Info...), label...)
+}
+
+func (s *Session) generateDH() (*x25519.KeyPair, error) {
+	random := s.rand
+	if random == nil {
+		random = rand.Reader
+	}
+
+	privKey := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(random, privKey); err != nil {
+		return nil, err
+	}
+	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &x25519.KeyPair{PrivateKey: privKey, PublicKey: pubKey}, nil
+}
@@ -0,0 +1,434 @@
+// Package ratchet implements the Signal Double Ratchet algorithm
+// (https://signal.org/docs/specifications/doubleratchet/) with X25519 DH
+// ratchet steps, bounded storage of skipped message keys, optional header
+// encryption and serializable session state.
+//
+// Sessions are usually started from an X3DH result: the initiator uses the
+// shared secret and the responder's signed prekey, the responder uses the
+// shared secret and the signed prekey's key pair.
+package ratchet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+)
+
+const (
+	DefaultMaxSkip        = 1000
+	DefaultMaxSkippedKeys = 2000
+
+	headerSize    = curve25519.PointSize + 4 + 4
+	encHeaderSize = chacha20poly1305.NonceSizeX + headerSize + chacha20poly1305.Overhead
+)
+
+var (
+	ErrNoSendingChain = errors.New("ratchet: cannot send before receiving the first message")
+	ErrTooManySkipped = errors.New("ratchet: too many skipped messages")
+	ErrInvalidMessage = errors.New("ratchet: malformed message")
+	ErrDecrypt        = errors.New("ratchet: message authentication failed")
+)
+
+// Options configures a session. The zero value is usable.
+type Options struct {
+	// Info is the application-specific KDF info prefix.
+	Info []byte
+	// HeaderEncryption hides the ratchet public key and counters of each
+	// message. Both parties must agree on it.
+	HeaderEncryption bool
+	// MaxSkip bounds how many message keys a single message may skip.
+	MaxSkip int
+	// MaxSkippedKeys bounds how many skipped keys are kept in total; the
+	// oldest are dropped first.
+	MaxSkippedKeys int
+	// Rand is the source of ratchet key pairs, crypto/rand if nil. It is
+	// not part of the serialized state.
+	Rand io.Reader
+}
+
+// Session is one side of a Double Ratchet conversation. It is not safe for
+// concurrent use.
+type Session struct {
+	st   state
+	rand io.Reader
+}
+
+type state struct {
+	Info             []byte `json:"info,omitempty"`
+	HeaderEncryption bool   `json:"headerEncryption"`
+	MaxSkip          int    `json:"maxSkip"`
+	MaxSkippedKeys   int    `json:"maxSkippedKeys"`
+
+	DHs *x25519.KeyPair `json:"dhs"`
+	DHr []byte          `json:"dhr,omitempty"`
+	RK  []byte          `json:"rk"`
+	CKs []byte          `json:"cks,omitempty"`
+	CKr []byte          `json:"ckr,omitempty"`
+	Ns  uint32          `json:"ns"`
+	Nr  uint32          `json:"nr"`
+	PN  uint32          `json:"pn"`
+
+	HKs  []byte `json:"hks,omitempty"`
+	HKr  []byte `json:"hkr,omitempty"`
+	NHKs []byte `json:"nhks,omitempty"`
+	NHKr []byte `json:"nhkr,omitempty"`
+
+	// Skipped holds message keys of skipped messages, oldest first. Chain
+	// is the sender's ratchet public key, or the header key when header
+	// encryption is on.
+	Skipped []skippedKey `json:"skipped,omitempty"`
+}
+
+type skippedKey struct {
+	Chain []byte `json:"chain"`
+	N     uint32 `json:"n"`
+	MK    []byte `json:"mk"`
+}
+
+func newSession(opts *Options) *Session {
+	s := &Session{}
+	if opts != nil {
+		s.st.Info = append([]byte(nil), opts.Info...)
+		s.st.HeaderEncryption = opts.HeaderEncryption
+		s.st.MaxSkip = opts.MaxSkip
+		s.st.MaxSkippedKeys = opts.MaxSkippedKeys
+		s.rand = opts.Rand
+	}
+	if s.st.MaxSkip <= 0 {
+		s.st.MaxSkip = DefaultMaxSkip
+	}
+	if s.st.MaxSkippedKeys <= 0 {
+		s.st.MaxSkippedKeys = DefaultMaxSkippedKeys
+	}
+	return s
+}
+
+// NewInitiator starts the session of the party that sends first, given the
+// shared secret and the peer's ratchet public key.
+func NewInitiator(sharedSecret, peerRatchetKey []byte, opts *Options) (*Session, error) {
+	if len(peerRatchetKey) != curve25519.PointSize {
+		return nil, ErrInvalidMessage
+	}
+
+	s := newSession(opts)
+	dhs, err := s.generateDH()
+	if err != nil {
+		return nil, err
+	}
+	dhOut, err := curve25519.X25519(dhs.PrivateKey, peerRatchetKey)
+	if err != nil {
+		return nil, err
+	}
+
+	s.st.DHs = dhs
+	s.st.DHr = append([]byte(nil), peerRatchetKey...)
+	if s.st.RK, s.st.CKs, s.st.NHKs, err = s.kdfRK(sharedSecret, dhOut); err != nil {
+		return nil, err
+	}
+
+	if s.st.HeaderEncryption {
+		if s.st.HKs, s.st.NHKr, err = s.headerKeys(sharedSecret); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// NewResponder starts the session of the party that receives first, given
+// the shared secret and the ratchet key pair the initiator was told about.
+func NewResponder(sharedSecret []byte, ratchetKeyPair *x25519.KeyPair, opts *Options) (*Session, error) {
+	s := newSession(opts)
+	s.st.DHs = &x25519.KeyPair{
+		PrivateKey: append([]byte(nil), ratchetKeyPair.PrivateKey...),
+		PublicKey:  append([]byte(nil), ratchetKeyPair.PublicKey...),
+	}
+	s.st.RK = append([]byte(nil), sharedSecret...)
+
+	if s.st.HeaderEncryption {
+		var err error
+		if s.st.NHKr, s.st.NHKs, err = s.headerKeys(sharedSecret); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// SetRand sets the source of ratchet key pairs of a restored session.
+func (s *Session) SetRand(r io.Reader) {
+	s.rand = r
+}
+
+// Encrypt encrypts plaintext as the next message, authenticating ad along
+// with the message header.
+func (s *Session) Encrypt(plaintext, ad []byte) ([]byte, error) {
+	if s.st.CKs == nil {
+		return nil, ErrNoSendingChain
+	}
+
+	ck, mk := kdfCK(s.st.CKs)
+	hdr := encodeHeader(s.st.DHs.PublicKey, s.st.PN, s.st.Ns)
+
+	if s.st.HeaderEncryption {
+		var err error
+		if hdr, err = s.encryptHeader(s.st.HKs, hdr); err != nil {
+			return nil, err
+		}
+	}
+
+	out, err := s.seal(mk, hdr, plaintext, ad)
+	if err != nil {
+		return nil, err
+	}
+
+	s.st.CKs = ck
+	s.st.Ns++
+	return out, nil
+}
+
+// Decrypt authenticates and decrypts a message. If it fails the session is
+// left unchanged.
+func (s *Session) Decrypt(message, ad []byte) ([]byte, error) {
+	saved := s.st
+	saved.Skipped = append([]skippedKey(nil), s.st.Skipped...)
+
+	plaintext, err := s.decrypt(message, ad)
+	if err != nil {
+		s.st = saved
+		return nil, err
+	}
+	return plaintext, nil
+}
+
+func (s *Session) decrypt(message, ad []byte) ([]byte, error) {
+	size := headerSize
+	if s.st.HeaderEncryption {
+		size = encHeaderSize
+	}
+	if len(message) < size+chacha20poly1305.Overhead {
+		return nil, ErrInvalidMessage
+	}
+	hdr, body := message[:size], message[size:]
+
+	if plaintext, ok, err := s.trySkipped(hdr, body, ad); ok || err != nil {
+		return plaintext, err
+	}
+
+	var dh []byte
+	var pn, n uint32
+	ratchetStep := false
+	if s.st.HeaderEncryption {
+		plainHdr, step, err := s.decryptHeader(hdr)
+		if err != nil {
+			return nil, err
+		}
+		dh, pn, n = decodeHeader(plainHdr)
+		ratchetStep = step
+	} else {
+		dh, pn, n = decodeHeader(hdr)
+		ratchetStep = !bytes.Equal(dh, s.st.DHr)
+	}
+
+	if ratchetStep {
+		if err := s.skipMessageKeys(pn); err != nil {
+			return nil, err
+		}
+		if err := s.dhRatchet(dh); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.skipMessageKeys(n); err != nil {
+		return nil, err
+	}
+
+	ck, mk := kdfCK(s.st.CKr)
+	s.st.CKr = ck
+	s.st.Nr++
+	return s.open(mk, hdr, body, ad)
+}
+
+func (s *Session) trySkipped(hdr, body, ad []byte) ([]byte, bool, error) {
+	for i, sk := range s.st.Skipped {
+		if s.st.HeaderEncryption {
+			plainHdr, err := openHeader(sk.Chain, hdr)
+			if err != nil {
+				continue
+			}
+			if _, _, n := decodeHeader(plainHdr); n != sk.N {
+				continue
+			}
+		} else if dh, _, n := decodeHeader(hdr); n != sk.N || !bytes.Equal(dh, sk.Chain) {
+			continue
+		}
+
+		s.st.Skipped = append(s.st.Skipped[:i:i], s.st.Skipped[i+1:]...)
+		plaintext, err := s.open(sk.MK, hdr, body, ad)
+		return plaintext, true, err
+	}
+	return nil, false, nil
+}
+
+func (s *Session) skipMessageKeys(until uint32) error {
+	if uint64(s.st.Nr)+uint64(s.st.MaxSkip) < uint64(until) {
+		return ErrTooManySkipped
+	}
+	if s.st.CKr == nil {
+		return nil
+	}
+
+	chain := s.st.DHr
+	if s.st.HeaderEncryption {
+		chain = s.st.HKr
+	}
+	for s.st.Nr < until {
+		ck, mk := kdfCK(s.st.CKr)
+		s.st.Skipped = append(s.st.Skipped, skippedKey{Chain: chain, N: s.st.Nr, MK: mk})
+		s.st.CKr = ck
+		s.st.Nr++
+	}
+	if extra := len(s.st.Skipped) - s.st.MaxSkippedKeys; extra > 0 {
+		s.st.Skipped = append([]skippedKey(nil), s.st.Skipped[extra:]...)
+	}
+	return nil
+}
+
+func (s *Session) dhRatchet(dh []byte) error {
+	s.st.PN = s.st.Ns
+	s.st.Ns = 0
+	s.st.Nr = 0
+	s.st.HKs = s.st.NHKs
+	s.st.HKr = s.st.NHKr
+	s.st.DHr = append([]byte(nil), dh...)
+
+	dhOut, err := curve25519.X25519(s.st.DHs.PrivateKey, s.st.DHr)
+	if err != nil {
+		return err
+	}
+	if s.st.RK, s.st.CKr, s.st.NHKr, err = s.kdfRK(s.st.RK, dhOut); err != nil {
+		return err
+	}
+
+	if s.st.DHs, err = s.generateDH(); err != nil {
+		return err
+	}
+	if dhOut, err = curve25519.X25519(s.st.DHs.PrivateKey, s.st.DHr); err != nil {
+		return err
+	}
+	s.st.RK, s.st.CKs, s.st.NHKs, err = s.kdfRK(s.st.RK, dhOut)
+	return err
+}
+
+func (s *Session) decryptHeader(hdr []byte) ([]byte, bool, error) {
+	if s.st.HKr != nil {
+		if plainHdr, err := openHeader(s.st.HKr, hdr); err == nil {
+			return plainHdr, false, nil
+		}
+	}
+	if s.st.NHKr != nil {
+		if plainHdr, err := openHeader(s.st.NHKr, hdr); err == nil {
+			return plainHdr, true, nil
+		}
+	}
+	return nil, false, ErrDecrypt
+}
+
+func (s *Session) encryptHeader(hk, hdr []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(hk)
+	if err != nil {
+		return nil, err
+	}
+	random := s.rand
+	if random == nil {
+		random = rand.Reader
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSizeX, encHeaderSize)
+	if _, err := io.ReadFull(random, nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, hdr, nil), nil
+}
+
+func openHeader(hk, encHdr []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(hk)
+	if err != nil {
+		return nil, err
+	}
+	nonce, ciphertext := encHdr[:chacha20poly1305.NonceSizeX], encHdr[chacha20poly1305.NonceSizeX:]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// seal returns hdr followed by the encryption of plaintext under mk, with ad
+// and hdr as associated data.
+func (s *Session) seal(mk, hdr, plaintext, ad []byte) ([]byte, error) {
+	key, nonce, err := s.messageCipher(mk)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(nil), hdr...)
+	return aead.Seal(out, nonce, plaintext, concat(ad, hdr)), nil
+}
+
+func (s *Session) open(mk, hdr, body, ad []byte) ([]byte, error) {
+	key, nonce, err := s.messageCipher(mk)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, body, concat(ad, hdr))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	return plaintext, nil
+}
+
+// MarshalJSON serializes the complete session state, including private
+// keys. Treat the output as secret.
+func (s *Session) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&s.st)
+}
+
+func (s *Session) UnmarshalJSON(data []byte) error {
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	if st.DHs == nil || len(st.RK) != keySize {
+		return errors.New("ratchet: invalid session state")
+	}
+	s.st = st
+	return nil
+}
+
+func encodeHeader(dh []byte, pn, n uint32) []byte {
+	hdr := make([]byte, 0, headerSize)
+	hdr = append(hdr, dh...)
+	hdr = binary.BigEndian.AppendUint32(hdr, pn)
+	hdr = binary.BigEndian.AppendUint32(hdr, n)
+	return hdr
+}
+
+func decodeHeader(hdr []byte) (dh []byte, pn, n uint32) {
+	dh = hdr[:curve25519.PointSize]
+	pn = binary.BigEndian.Uint32(hdr[curve25519.PointSize:])
+	n = binary.BigEndian.Uint32(hdr[curve25519.PointSize+4:])
+	return dh, pn, n
+}
+
+func concat(a, b []byte) []byte {
+	return append(append(make([]byte, 0, len(a)+len(b)), a...), b...)
+}
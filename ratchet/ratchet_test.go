@@ -0,0 +1,200 @@
+package ratchet
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+var testAD = []byte("associated data")
+
+func newPair(t *testing.T, opts *Options) (alice, bob *Session) {
+	t.Helper()
+	sharedSecret := make([]byte, keySize)
+	if _, err := rand.Read(sharedSecret); err != nil {
+		t.Fatal(err)
+	}
+	privKey := make([]byte, curve25519.ScalarSize)
+	if _, err := rand.Read(privKey); err != nil {
+		t.Fatal(err)
+	}
+	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if alice, err = NewInitiator(sharedSecret, pubKey, opts); err != nil {
+		t.Fatal(err)
+	}
+	if bob, err = NewResponder(sharedSecret, &x25519.KeyPair{PrivateKey: privKey, PublicKey: pubKey}, opts); err != nil {
+		t.Fatal(err)
+	}
+	return alice, bob
+}
+
+func encryptN(t *testing.T, s *Session, prefix string, n int) [][]byte {
+	t.Helper()
+	msgs := make([][]byte, n)
+	for i := range msgs {
+		var err error
+		if msgs[i], err = s.Encrypt([]byte(fmt.Sprintf("%s %d", prefix, i)), testAD); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return msgs
+}
+
+func mustDecrypt(t *testing.T, s *Session, msg []byte, want string) {
+	t.Helper()
+	got, err := s.Decrypt(msg, testAD)
+	if err != nil {
+		t.Fatalf("decrypting %q: %v", want, err)
+	}
+	if string(got) != want {
+		t.Fatalf("decrypted %q, want %q", got, want)
+	}
+}
+
+// forEachMode runs f with and without header encryption.
+func forEachMode(t *testing.T, opts Options, f func(t *testing.T, opts *Options)) {
+	for _, he := range []bool{false, true} {
+		opts := opts
+		opts.HeaderEncryption = he
+		t.Run(fmt.Sprintf("HeaderEncryption=%v", he), func(t *testing.T) {
+			f(t, &opts)
+		})
+	}
+}
+
+func TestConversation(t *testing.T) {
+	forEachMode(t, Options{}, func(t *testing.T, opts *Options) {
+		alice, bob := newPair(t, opts)
+
+		if _, err := bob.Encrypt([]byte("too early"), testAD); err != ErrNoSendingChain {
+			t.Fatalf("responder sent first: err = %v, want ErrNoSendingChain", err)
+		}
+
+		for round := 0; round < 3; round++ {
+			for i, m := range encryptN(t, alice, fmt.Sprintf("alice %d", round), 2) {
+				mustDecrypt(t, bob, m, fmt.Sprintf("alice %d %d", round, i))
+			}
+			for i, m := range encryptN(t, bob, fmt.Sprintf("bob %d", round), 2) {
+				mustDecrypt(t, alice, m, fmt.Sprintf("bob %d %d", round, i))
+			}
+		}
+	})
+}
+
+func TestOutOfOrder(t *testing.T) {
+	forEachMode(t, Options{}, func(t *testing.T, opts *Options) {
+		alice, bob := newPair(t, opts)
+
+		msgs := encryptN(t, alice, "a", 5)
+		for _, i := range []int{3, 0, 4, 1, 2} {
+			mustDecrypt(t, bob, msgs[i], fmt.Sprintf("a %d", i))
+		}
+
+		// Skipped keys are deleted once used, so a replay fails.
+		if _, err := bob.Decrypt(msgs[0], testAD); err == nil {
+			t.Fatal("replayed message decrypted")
+		}
+	})
+}
+
+func TestSkippedAcrossRatchetStep(t *testing.T) {
+	forEachMode(t, Options{}, func(t *testing.T, opts *Options) {
+		alice, bob := newPair(t, opts)
+
+		first := encryptN(t, alice, "first", 3)
+		mustDecrypt(t, bob, first[2], "first 2")
+
+		reply := encryptN(t, bob, "reply", 1)
+		mustDecrypt(t, alice, reply[0], "reply 0")
+
+		// Alice's next chain starts after a DH ratchet step; the header
+		// tells bob how long the previous chain was.
+		second := encryptN(t, alice, "second", 2)
+		mustDecrypt(t, bob, second[1], "second 1")
+		mustDecrypt(t, bob, first[0], "first 0")
+		mustDecrypt(t, bob, second[0], "second 0")
+		mustDecrypt(t, bob, first[1], "first 1")
+	})
+}
+
+func TestMaxSkipExceeded(t *testing.T) {
+	forEachMode(t, Options{MaxSkip: 3}, func(t *testing.T, opts *Options) {
+		alice, bob := newPair(t, opts)
+
+		msgs := encryptN(t, alice, "a", 5)
+		if _, err := bob.Decrypt(msgs[4], testAD); err != ErrTooManySkipped {
+			t.Fatalf("skipping 4 messages: err = %v, want ErrTooManySkipped", err)
+		}
+
+		// The failed message leaves the session unchanged, and skipping
+		// exactly MaxSkip messages is allowed.
+		mustDecrypt(t, bob, msgs[3], "a 3")
+		for i := 0; i < 3; i++ {
+			mustDecrypt(t, bob, msgs[i], fmt.Sprintf("a %d", i))
+		}
+		mustDecrypt(t, bob, msgs[4], "a 4")
+	})
+}
+
+func TestMaxSkippedKeys(t *testing.T) {
+	alice, bob := newPair(t, &Options{MaxSkippedKeys: 2})
+
+	msgs := encryptN(t, alice, "a", 4)
+	mustDecrypt(t, bob, msgs[3], "a 3")
+
+	// Only the two newest skipped keys are kept.
+	if _, err := bob.Decrypt(msgs[0], testAD); err == nil {
+		t.Fatal("decrypted a message whose skipped key should have been dropped")
+	}
+	mustDecrypt(t, bob, msgs[1], "a 1")
+	mustDecrypt(t, bob, msgs[2], "a 2")
+}
+
+func TestTamperedMessage(t *testing.T) {
+	forEachMode(t, Options{}, func(t *testing.T, opts *Options) {
+		alice, bob := newPair(t, opts)
+
+		msg := encryptN(t, alice, "a", 1)[0]
+		tampered := bytes.Clone(msg)
+		tampered[len(tampered)-1] ^= 1
+		if _, err := bob.Decrypt(tampered, testAD); err == nil {
+			t.Fatal("tampered message decrypted")
+		}
+		if _, err := bob.Decrypt(msg, []byte("other associated data")); err == nil {
+			t.Fatal("message decrypted with the wrong associated data")
+		}
+		mustDecrypt(t, bob, msg, "a 0")
+	})
+}
+
+func TestSessionJSON(t *testing.T) {
+	forEachMode(t, Options{}, func(t *testing.T, opts *Options) {
+		alice, bob := newPair(t, opts)
+
+		msgs := encryptN(t, alice, "a", 3)
+		mustDecrypt(t, bob, msgs[2], "a 2")
+
+		data, err := json.Marshal(bob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var restored Session
+		if err := json.Unmarshal(data, &restored); err != nil {
+			t.Fatal(err)
+		}
+
+		mustDecrypt(t, &restored, msgs[0], "a 0")
+		mustDecrypt(t, &restored, msgs[1], "a 1")
+		reply := encryptN(t, &restored, "b", 1)
+		mustDecrypt(t, alice, reply[0], "b 0")
+	})
+}
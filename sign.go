@@ -13,3 +13,28 @@ func SignMsg(privKey PrivateKey, msg []byte) []byte {
 func VerifyMsg(pubKey PublicKey, originMsg, signMsg []byte) bool {
 	return ed25519.Verify(pubKey[:], originMsg, signMsg)
 }
+
+// 用私钥对消息做 Ed25519ph 签名
+func SignMsgPh(privKey PrivateKey, msg []byte, context string) ([]byte, error) {
+	return privKey.SignMsgPh(msg, context)
+}
+
+// 用公钥校验 Ed25519ph 签名
+func VerifyMsgPh(pubKey PublicKey, originMsg, signMsg []byte, context string) bool {
+	return pubKey.VerifyMsgPh(originMsg, signMsg, context)
+}
+
+// 用私钥对消息做 Ed25519ctx 签名
+func SignMsgCtx(privKey PrivateKey, msg []byte, context string) ([]byte, error) {
+	return privKey.SignMsgCtx(msg, context)
+}
+
+// 用公钥校验 Ed25519ctx 签名
+func VerifyMsgCtx(pubKey PublicKey, originMsg, signMsg []byte, context string) bool {
+	return pubKey.VerifyMsgCtx(originMsg, signMsg, context)
+}
+
+// 按指定规则用公钥校验签名消息
+func VerifyMsgWithMode(pubKey PublicKey, originMsg, signMsg []byte, mode VerifyMode) bool {
+	return pubKey.VerifyMsgWithMode(originMsg, signMsg, mode)
+}
@@ -0,0 +1,178 @@
+package key25519
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// Test vectors from RFC 8032, sections 7.2 (Ed25519ctx) and 7.3 (Ed25519ph).
+var rfc8032Vectors = []struct {
+	name      string
+	ph        bool
+	seed      string
+	pubKey    string
+	msg       string
+	context   string
+	signature string
+}{
+	{
+		name:      "Ed25519ctx foo",
+		seed:      "0305334e381af78f141cb666f6199f57bc3495335a256a95bd2a55bf546663f6",
+		pubKey:    "dfc9425e4f968f7f0c29f0259cf5f9aed6851c2bb4ad8bfb860cfee0ab248292",
+		msg:       "f726936d19c800494e3fdaff20b276a8",
+		context:   "foo",
+		signature: "55a4cc2f70a54e04288c5f4cd1e45a7bb520b36292911876cada7323198dd87a8b36950b95130022907a7fb7c4e9b2d5f6cca685a587b4b21f4b888e4e7edb0d",
+	},
+	{
+		name:      "Ed25519ctx bar",
+		seed:      "0305334e381af78f141cb666f6199f57bc3495335a256a95bd2a55bf546663f6",
+		pubKey:    "dfc9425e4f968f7f0c29f0259cf5f9aed6851c2bb4ad8bfb860cfee0ab248292",
+		msg:       "f726936d19c800494e3fdaff20b276a8",
+		context:   "bar",
+		signature: "fc60d5872fc46b3aa69f8b5b4351d5808f92bcc044606db097abab6dbcb1aee3216c48e8b3b66431b5b186d1d28f8ee15a5ca2df6668346291c2043d4eb3e90d",
+	},
+	{
+		name:      "Ed25519ctx foo other message",
+		seed:      "0305334e381af78f141cb666f6199f57bc3495335a256a95bd2a55bf546663f6",
+		pubKey:    "dfc9425e4f968f7f0c29f0259cf5f9aed6851c2bb4ad8bfb860cfee0ab248292",
+		msg:       "508e9e6882b979fea900f62adceaca35",
+		context:   "foo",
+		signature: "8b70c1cc8310e1de20ac53ce28ae6e7207f33c3295e03bb5c0732a1d20dc64908922a8b052cf99b7c4fe107a5abb5b2c4085ae75890d02df26269d8945f84b0b",
+	},
+	{
+		name:      "Ed25519ctx foo other key",
+		seed:      "ab9c2853ce297ddab85c993b3ae14bcad39b2c682beabc27d6d4eb20711d6560",
+		pubKey:    "0f1d1274943b91415889152e893d80e93275a1fc0b65fd71b4b0dda10ad7d772",
+		msg:       "f726936d19c800494e3fdaff20b276a8",
+		context:   "foo",
+		signature: "21655b5f1aa965996b3f97b3c849eafba922a0a62992f73b3d1b73106a84ad85e9b86a7b6005ea868337ff2d20a7f5fbd4cd10b0be49a68da2b2e0dc0ad8960f",
+	},
+	{
+		name:      "Ed25519ph abc",
+		ph:        true,
+		seed:      "833fe62409237b9d62ec77587520911e9a759cec1d19755b7da901b96dca3d42",
+		pubKey:    "ec172b93ad5e563bf4932c70e1245034c35467ef2efd4d64ebf819683467e2bf",
+		msg:       "616263",
+		signature: "98a70222f0b8121aa9d30f813d683f809e462b469c7ff87639499bb94e6dae4131f85042463c2a355a2003d062adf5aaa10b8c61e636062aaad11c2a26083406",
+	},
+}
+
+func TestRFC8032PhCtx(t *testing.T) {
+	for _, v := range rfc8032Vectors {
+		v := v
+		t.Run(v.name, func(t *testing.T) {
+			privKey, err := NewPrivateKeyFromSeed(decodeHex(t, v.seed))
+			if err != nil {
+				t.Fatal(err)
+			}
+			pubKey := privKey.GetPubKey()
+			if got := hex.EncodeToString(pubKey.Bytes()); got != v.pubKey {
+				t.Fatalf("public key = %s, want %s", got, v.pubKey)
+			}
+			msg, want := decodeHex(t, v.msg), decodeHex(t, v.signature)
+
+			sign, verify := SignMsgCtx, VerifyMsgCtx
+			if v.ph {
+				sign, verify = SignMsgPh, VerifyMsgPh
+			}
+
+			sig, err := sign(privKey, msg, v.context)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sig, want) {
+				t.Fatalf("signature = %x, want %s", sig, v.signature)
+			}
+			if !verify(pubKey, msg, sig, v.context) {
+				t.Fatal("valid signature rejected")
+			}
+			if verify(pubKey, msg, sig, v.context+"x") {
+				t.Fatal("signature accepted under a different context")
+			}
+			if VerifyMsg(pubKey, msg, sig) {
+				t.Fatal("signature accepted as plain Ed25519")
+			}
+
+			if !v.ph {
+				return
+			}
+
+			// StreamSigner must produce the same signature however the
+			// input is split.
+			s := NewStreamSigner(privKey, v.context)
+			for _, b := range msg {
+				s.Write([]byte{b})
+			}
+			if sig, err = s.Sign(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sig, want) {
+				t.Fatalf("StreamSigner signature = %x, want %s", sig, v.signature)
+			}
+
+			sv := NewStreamVerifier(pubKey, v.context)
+			sv.Write(msg)
+			if !sv.Verify(want) {
+				t.Fatal("StreamVerifier rejected a valid signature")
+			}
+
+			if sig, err = privKey.SignReader(bytes.NewReader(msg), v.context); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(sig, want) {
+				t.Fatalf("SignReader signature = %x, want %s", sig, v.signature)
+			}
+			if ok, err := pubKey.VerifyReader(bytes.NewReader(msg), want, v.context); err != nil || !ok {
+				t.Fatalf("VerifyReader = %v, %v", ok, err)
+			}
+		})
+	}
+}
+
+func TestStreamSignerLargeInput(t *testing.T) {
+	privKey, err := NewPrivateKeyFromSeed(decodeHex(t, rfc8032Vectors[4].seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := bytes.Repeat([]byte("key25519"), 1<<16)
+
+	s := NewStreamSigner(privKey, "ctx")
+	if _, err := s.ReadFrom(bytes.NewReader(msg)); err != nil {
+		t.Fatal(err)
+	}
+	sig, err := s.Sign()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := SignMsgPh(privKey, msg, "ctx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(sig, want) {
+		t.Fatal("StreamSigner and SignMsgPh disagree")
+	}
+}
+
+func TestContextLimits(t *testing.T) {
+	privKey, err := NewPrivateKeyFromSeed(decodeHex(t, rfc8032Vectors[0].seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("message")
+
+	if _, err := SignMsgCtx(privKey, msg, ""); err == nil {
+		t.Error("Ed25519ctx accepted an empty context")
+	}
+	long := strings.Repeat("c", 256)
+	if _, err := SignMsgCtx(privKey, msg, long); err == nil {
+		t.Error("Ed25519ctx accepted a 256-byte context")
+	}
+	if _, err := SignMsgPh(privKey, msg, long); err == nil {
+		t.Error("Ed25519ph accepted a 256-byte context")
+	}
+	if _, err := SignMsgCtx(privKey, msg, long[:255]); err != nil {
+		t.Errorf("Ed25519ctx rejected a 255-byte context: %v", err)
+	}
+}
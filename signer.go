@@ -0,0 +1,47 @@
+package key25519
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"io"
+)
+
+var (
+	_ crypto.Signer = PrivateKey{}
+	_ crypto.Signer = (*KeyPair)(nil)
+)
+
+// Public returns the ed25519.PublicKey of the private key, so that
+// PrivateKey satisfies crypto.Signer.
+func (pk PrivateKey) Public() crypto.PublicKey {
+	return pk.GetPubKey().ToEd25519PubKey()
+}
+
+// Sign implements crypto.Signer. opts selects the variant as in
+// ed25519.PrivateKey.Sign: crypto.Hash(0) for pure Ed25519, crypto.SHA512
+// for Ed25519ph with message being the SHA-512 digest, or *ed25519.Options
+// to also set an Ed25519ctx/Ed25519ph context. rand is ignored.
+func (pk PrivateKey) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return pk.ToEd25519PrivKey().Sign(rand, message, opts)
+}
+
+func (kp *KeyPair) Public() crypto.PublicKey {
+	return kp.pubKey.ToEd25519PubKey()
+}
+
+func (kp *KeyPair) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return kp.privKey.Sign(rand, message, opts)
+}
+
+func (pk PublicKey) ToEd25519PubKey() ed25519.PublicKey {
+	var edPubKey = make([]byte, ed25519.PublicKeySize)
+	copy(edPubKey, pk.Bytes())
+
+	return edPubKey
+}
+
+// CryptoPublicKey returns the key as a crypto.PublicKey (an
+// ed25519.PublicKey) for APIs such as x509 and tls.
+func (pk PublicKey) CryptoPublicKey() crypto.PublicKey {
+	return pk.ToEd25519PubKey()
+}
@@ -0,0 +1,75 @@
+package key25519
+
+import (
+	"crypto/sha512"
+	"hash"
+	"io"
+)
+
+// StreamSigner produces an Ed25519ph signature over everything written to
+// it, so arbitrarily large inputs can be signed without holding them in
+// memory. The signature equals SignMsgPh over the concatenated input.
+type StreamSigner struct {
+	privKey PrivateKey
+	context string
+	h       hash.Hash
+}
+
+func NewStreamSigner(privKey PrivateKey, context string) *StreamSigner {
+	return &StreamSigner{privKey: privKey, context: context, h: sha512.New()}
+}
+
+func (s *StreamSigner) Write(p []byte) (int, error) {
+	return s.h.Write(p)
+}
+
+func (s *StreamSigner) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(s.h, r)
+}
+
+// Sign returns the signature of the data written so far.
+func (s *StreamSigner) Sign() ([]byte, error) {
+	return s.privKey.signDigest(s.h.Sum(nil), s.context)
+}
+
+// StreamVerifier checks an Ed25519ph signature over everything written to it.
+type StreamVerifier struct {
+	pubKey  PublicKey
+	context string
+	h       hash.Hash
+}
+
+func NewStreamVerifier(pubKey PublicKey, context string) *StreamVerifier {
+	return &StreamVerifier{pubKey: pubKey, context: context, h: sha512.New()}
+}
+
+func (v *StreamVerifier) Write(p []byte) (int, error) {
+	return v.h.Write(p)
+}
+
+func (v *StreamVerifier) ReadFrom(r io.Reader) (int64, error) {
+	return io.Copy(v.h, r)
+}
+
+// Verify reports whether signMsg is valid for the data written so far.
+func (v *StreamVerifier) Verify(signMsg []byte) bool {
+	return v.pubKey.verifyDigest(v.h.Sum(nil), signMsg, v.context)
+}
+
+// SignReader signs everything read from r with Ed25519ph.
+func (pk PrivateKey) SignReader(r io.Reader, context string) ([]byte, error) {
+	s := NewStreamSigner(pk, context)
+	if _, err := s.ReadFrom(r); err != nil {
+		return nil, err
+	}
+	return s.Sign()
+}
+
+// VerifyReader verifies an Ed25519ph signature over everything read from r.
+func (pk PublicKey) VerifyReader(r io.Reader, signMsg []byte, context string) (bool, error) {
+	v := NewStreamVerifier(pk, context)
+	if _, err := v.ReadFrom(r); err != nil {
+		return false, err
+	}
+	return v.Verify(signMsg), nil
+}
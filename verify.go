@@ -0,0 +1,117 @@
+package key25519
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha512"
+
+	"filippo.io/edwards25519"
+)
+
+// VerifyMode selects the acceptance rules for Ed25519 signatures. The
+// specifications disagree on edge cases such as non-canonical point
+// encodings and small-order components, which matters whenever different
+// parties must reach the same verdict.
+type VerifyMode uint8
+
+const (
+	// VerifyDefault uses crypto/ed25519, like VerifyMsg.
+	VerifyDefault VerifyMode = iota
+	// VerifyStrict follows RFC 8032 strictly: A and R must be canonical
+	// encodings of points that are not of small order, S must be below
+	// the group order and the cofactorless equation [S]B = R + [k]A must
+	// hold.
+	VerifyStrict
+	// VerifyZIP215 follows ZIP-215: A and R may use non-canonical
+	// encodings, S must be below the group order and the cofactored
+	// equation [8][S]B = [8]R + [8][k]A must hold. Every valid ZIP-215
+	// signature is accepted the same way by all conforming verifiers,
+	// which makes it suitable for consensus.
+	VerifyZIP215
+)
+
+// VerifyMsgWithMode verifies signMsg over originMsg with the given rules.
+func (pk PublicKey) VerifyMsgWithMode(originMsg, signMsg []byte, mode VerifyMode) bool {
+	switch mode {
+	case VerifyDefault:
+		return ed25519.Verify(pk[:], originMsg, signMsg)
+	case VerifyStrict:
+		return pk.verifyStrict(originMsg, signMsg)
+	case VerifyZIP215:
+		return pk.verifyZIP215(originMsg, signMsg)
+	default:
+		return false
+	}
+}
+
+func (pk PublicKey) verifyStrict(msg, sig []byte) bool {
+	if len(sig) != ed25519.SignatureSize {
+		return false
+	}
+
+	A, err := pk.point()
+	if err != nil {
+		return false
+	}
+	var rBytes PublicKey
+	copy(rBytes[:], sig[:32])
+	if _, err := rBytes.point(); err != nil {
+		return false
+	}
+
+	s, k, ok := signatureScalars(pk[:], msg, sig)
+	if !ok {
+		return false
+	}
+
+	// R' = [S]B - [k]A must encode to exactly the R of the signature.
+	minusA := new(edwards25519.Point).Negate(A)
+	check := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(k, minusA, s)
+	return bytes.Equal(check.Bytes(), sig[:32])
+}
+
+func (pk PublicKey) verifyZIP215(msg, sig []byte) bool {
+	if len(sig) != ed25519.SignatureSize {
+		return false
+	}
+
+	A, err := new(edwards25519.Point).SetBytes(pk[:])
+	if err != nil {
+		return false
+	}
+	R, err := new(edwards25519.Point).SetBytes(sig[:32])
+	if err != nil {
+		return false
+	}
+
+	s, k, ok := signatureScalars(pk[:], msg, sig)
+	if !ok {
+		return false
+	}
+
+	// [8]([S]B - [k]A - R) must be the identity.
+	minusA := new(edwards25519.Point).Negate(A)
+	check := new(edwards25519.Point).VarTimeDoubleScalarBaseMult(k, minusA, s)
+	check.Subtract(check, R)
+	check.MultByCofactor(check)
+	return check.Equal(edwards25519.NewIdentityPoint()) == 1
+}
+
+// signatureScalars decodes S, which must be canonical, and computes
+// k = SHA-512(R || A || M) from the encodings as given.
+func signatureScalars(pubKey, msg, sig []byte) (s, k *edwards25519.Scalar, ok bool) {
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(sig[32:])
+	if err != nil {
+		return nil, nil, false
+	}
+
+	h := sha512.New()
+	h.Write(sig[:32])
+	h.Write(pubKey)
+	h.Write(msg)
+	k, err = edwards25519.NewScalar().SetUniformBytes(h.Sum(nil))
+	if err != nil {
+		return nil, nil, false
+	}
+	return s, k, true
+}
@@ -0,0 +1,120 @@
+package key25519
+
+import (
+	"crypto/sha512"
+	"testing"
+
+	"filippo.io/edwards25519"
+)
+
+// nonCanonicalIdentity encodes the identity point with y = p + 1 instead of
+// y = 1.
+const nonCanonicalIdentity = "eeffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff7f"
+
+// groupOrder is the little-endian encoding of L, the order of the prime
+// subgroup.
+const groupOrder = "edd3f55c1a631258d69cf7a2def9de1400000000000000000000000000000010"
+
+// signMixedOrderKey signs msg under A + torsion, the public key of kp with a
+// small-order component, using kp's secret scalar.
+func signMixedOrderKey(t *testing.T, kp *KeyPair, msg []byte, torsion *edwards25519.Point) (PublicKey, []byte) {
+	t.Helper()
+	h := sha512.Sum512(kp.PrivateKey().ToEd25519PrivKey().Seed())
+	a, err := edwards25519.NewScalar().SetBytesWithClamping(h[:32])
+	if err != nil {
+		t.Fatal(err)
+	}
+	A, err := new(edwards25519.Point).SetBytes(kp.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pubKey PublicKey
+	copy(pubKey[:], new(edwards25519.Point).Add(A, torsion).Bytes())
+
+	r, err := edwards25519.NewScalar().SetUniformBytes(sha512.New().Sum(msg)[:64])
+	if err != nil {
+		t.Fatal(err)
+	}
+	R := new(edwards25519.Point).ScalarBaseMult(r)
+
+	kh := sha512.New()
+	kh.Write(R.Bytes())
+	kh.Write(pubKey[:])
+	kh.Write(msg)
+	k, err := edwards25519.NewScalar().SetUniformBytes(kh.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cofactorless verification would need k to be a multiple of 8.
+	if k.Bytes()[0]&7 == 0 {
+		t.Skip("k happens to kill the torsion component")
+	}
+	s := edwards25519.NewScalar().MultiplyAdd(k, a, r)
+	return pubKey, append(R.Bytes(), s.Bytes()...)
+}
+
+func TestZIP215EdgeCases(t *testing.T) {
+	kp, err := NewKeyPairFromSeed(decodeHex(t, rfc8032Vectors[0].seed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := []byte("ZIP-215")
+	valid := kp.PrivateKey().SignMsg(msg)
+
+	var smallOrder, nonCanonical PublicKey
+	copy(smallOrder[:], decodeHex(t, order8Point))
+	copy(nonCanonical[:], decodeHex(t, nonCanonicalIdentity))
+
+	// S + L encodes the same scalar with a non-canonical S.
+	sPlusL := make([]byte, 64)
+	copy(sPlusL, valid)
+	s, err := edwards25519.NewScalar().SetCanonicalBytes(valid[32:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var carry uint16
+	l := decodeHex(t, groupOrder)
+	for i, b := range s.Bytes() {
+		carry += uint16(b) + uint16(l[i])
+		sPlusL[32+i] = byte(carry)
+		carry >>= 8
+	}
+
+	mixedR := signWithTorsion(t, kp, msg, torsionPoint(t))
+	mixedA, mixedASig := signMixedOrderKey(t, kp, msg, torsionPoint(t))
+
+	tests := []struct {
+		name         string
+		pubKey       PublicKey
+		sig          []byte
+		strict, zip  bool
+		defaultValid bool
+	}{
+		{"valid", kp.PublicKey(), valid, true, true, true},
+		{"non-canonical S", kp.PublicKey(), sPlusL, false, false, false},
+		{"mixed-order R", kp.PublicKey(), mixedR, false, true, false},
+		{"mixed-order A", mixedA, mixedASig, false, true, false},
+		{"small-order A and R, S = 0", smallOrder, append(decodeHex(t, order8Point), make([]byte, 32)...), false, true, false},
+		{"non-canonical A and R, S = 0", nonCanonical, append(decodeHex(t, nonCanonicalIdentity), make([]byte, 32)...), false, true, false},
+		{"short signature", kp.PublicKey(), valid[:63], false, false, false},
+	}
+	for _, tt := range tests {
+		if got := tt.pubKey.VerifyMsgWithMode(msg, tt.sig, VerifyStrict); got != tt.strict {
+			t.Errorf("%s: VerifyStrict = %v, want %v", tt.name, got, tt.strict)
+		}
+		if got := tt.pubKey.VerifyMsgWithMode(msg, tt.sig, VerifyZIP215); got != tt.zip {
+			t.Errorf("%s: VerifyZIP215 = %v, want %v", tt.name, got, tt.zip)
+		}
+		if got := VerifyMsgWithMode(tt.pubKey, msg, tt.sig, VerifyDefault); got != tt.defaultValid {
+			t.Errorf("%s: VerifyDefault = %v, want %v", tt.name, got, tt.defaultValid)
+		}
+	}
+}
+
+func TestVerifyModeUnknown(t *testing.T) {
+	kp := NewKeyPair()
+	msg := []byte("message")
+	if kp.PublicKey().VerifyMsgWithMode(msg, kp.PrivateKey().SignMsg(msg), VerifyMode(99)) {
+		t.Fatal("unknown mode accepted a signature")
+	}
+}
@@ -1,17 +1,24 @@
 package x25519
 
 import (
-	"crypto/sha256"
-
 	"golang.org/x/crypto/curve25519"
 )
 
 func EcdhShare(privKey, peerPubKey []byte) ([]byte, error) {
+	return DeriveShare(privKey, peerPubKey, KDFLegacySHA256)
+}
+
+// DeriveShare performs X25519 and passes the result through kdf.
+func DeriveShare(privKey, peerPubKey []byte, kdf KDF) ([]byte, error) {
+	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
 	sharedSecret, err := curve25519.X25519(privKey, peerPubKey)
 	if err != nil {
 		return nil, err
 	}
 
-	hashedSecret := sha256.Sum256(sharedSecret)
-	return hashedSecret[:], nil
+	return kdf.Derive(sharedSecret, pubKey, peerPubKey)
 }
@@ -0,0 +1,87 @@
+package x25519
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// KDF turns the raw X25519 output into the secret returned to the caller.
+// pubKey and peerPubKey are the X25519 public keys of both parties and may
+// be used to bind the secret to the exchange.
+type KDF interface {
+	Derive(sharedSecret, pubKey, peerPubKey []byte) ([]byte, error)
+}
+
+var (
+	// KDFRaw returns the X25519 output unchanged, for protocols that run
+	// their own key schedule.
+	KDFRaw KDF = rawKDF{}
+	// KDFLegacySHA256 returns SHA-256 of the X25519 output. It is what
+	// EcdhShare has always returned.
+	KDFLegacySHA256 KDF = legacySHA256KDF{}
+)
+
+type rawKDF struct{}
+
+func (rawKDF) Derive(sharedSecret, _, _ []byte) ([]byte, error) {
+	return append([]byte(nil), sharedSecret...), nil
+}
+
+type legacySHA256KDF struct{}
+
+func (legacySHA256KDF) Derive(sharedSecret, _, _ []byte) ([]byte, error) {
+	hashedSecret := sha256.Sum256(sharedSecret)
+	return hashedSecret[:], nil
+}
+
+// HKDF derives the secret with RFC 5869 HKDF.
+type HKDF struct {
+	// Hash defaults to SHA-256.
+	Hash func() hash.Hash
+	Salt []byte
+	Info []byte
+	// Length is the output size in bytes, defaulting to the hash size.
+	Length int
+	// BindPublicKeys appends both public keys to Info, smaller one first,
+	// so the secret is tied to this exact pair of keys regardless of which
+	// side computes it.
+	BindPublicKeys bool
+}
+
+func (h HKDF) Derive(sharedSecret, pubKey, peerPubKey []byte) ([]byte, error) {
+	newHash := h.Hash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+
+	length := h.Length
+	if length == 0 {
+		length = newHash().Size()
+	}
+	if length < 0 || length > 255*newHash().Size() {
+		return nil, errors.New("x25519: invalid HKDF output length")
+	}
+
+	info := h.Info
+	if h.BindPublicKeys {
+		first, second := pubKey, peerPubKey
+		if bytes.Compare(first, second) > 0 {
+			first, second = second, first
+		}
+		info = make([]byte, 0, len(h.Info)+len(first)+len(second))
+		info = append(info, h.Info...)
+		info = append(info, first...)
+		info = append(info, second...)
+	}
+
+	out := make([]byte, length)
+	if _, err := io.ReadFull(hkdf.New(newHash, sharedSecret, h.Salt, info), out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,113 @@
+package x25519
+
+import (
+	"crypto/ecdh"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+
+	"github.com/lyonnee/key25519/pkcs8"
+)
+
+const pemPublicKeyType = "PUBLIC KEY"
+
+var (
+	ErrWrongKeyType = errors.New("x25519: not an X25519 key")
+	ErrNoPEMBlock   = errors.New("x25519: no public key PEM block found")
+)
+
+// MarshalPKCS8 encodes the private key as a PKCS#8 PrivateKeyInfo with the
+// X25519 OID 1.3.101.110 (RFC 8410).
+func (kp *KeyPair) MarshalPKCS8() ([]byte, error) {
+	key, err := ecdh.X25519().NewPrivateKey(kp.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKCS8PrivateKey(key)
+}
+
+// MarshalPEM encodes the private key as a PKCS#8 PEM block, encrypted under
+// password unless password is nil.
+func (kp *KeyPair) MarshalPEM(password []byte, opts *pkcs8.Options) ([]byte, error) {
+	der, err := kp.MarshalPKCS8()
+	if err != nil {
+		return nil, err
+	}
+	return pkcs8.EncodePEM(der, password, opts)
+}
+
+// MarshalPKIXPublicKey encodes an X25519 public key as a PKIX
+// SubjectPublicKeyInfo.
+func MarshalPKIXPublicKey(pubKey []byte) ([]byte, error) {
+	key, err := ecdh.X25519().NewPublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return x509.MarshalPKIXPublicKey(key)
+}
+
+// MarshalPublicKeyPEM encodes an X25519 public key as a "PUBLIC KEY" PEM
+// block.
+func MarshalPublicKeyPEM(pubKey []byte) ([]byte, error) {
+	der, err := MarshalPKIXPublicKey(pubKey)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: pemPublicKeyType, Bytes: der}), nil
+}
+
+// ParsePKCS8PrivateKey parses an unencrypted PKCS#8 X25519 private key, such
+// as one from `openssl genpkey -algorithm x25519`.
+func ParsePKCS8PrivateKey(der []byte) (*KeyPair, error) {
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdh.PrivateKey)
+	if !ok || ecKey.Curve() != ecdh.X25519() {
+		return nil, ErrWrongKeyType
+	}
+	return &KeyPair{
+		PrivateKey: ecKey.Bytes(),
+		PublicKey:  ecKey.PublicKey().Bytes(),
+	}, nil
+}
+
+// ParsePrivateKeyPEM parses the first "PRIVATE KEY" or "ENCRYPTED PRIVATE
+// KEY" block in data. password is only used for encrypted keys.
+func ParsePrivateKeyPEM(data, password []byte) (*KeyPair, error) {
+	der, err := pkcs8.DecodePEM(data, password)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePKCS8PrivateKey(der)
+}
+
+// ParsePKIXPublicKey parses a PKIX SubjectPublicKeyInfo X25519 public key.
+func ParsePKIXPublicKey(der []byte) ([]byte, error) {
+	key, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ecKey, ok := key.(*ecdh.PublicKey)
+	if !ok || ecKey.Curve() != ecdh.X25519() {
+		return nil, ErrWrongKeyType
+	}
+	return ecKey.Bytes(), nil
+}
+
+// ParsePublicKeyPEM parses the first "PUBLIC KEY" block in data.
+func ParsePublicKeyPEM(data []byte) ([]byte, error) {
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			return nil, ErrNoPEMBlock
+		}
+		if block.Type == pemPublicKeyType {
+			return ParsePKIXPublicKey(block.Bytes)
+		}
+		data = rest
+	}
+}
@@ -2,26 +2,45 @@ package x25519
 
 import (
 	"crypto/ed25519"
-	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
 
 	"golang.org/x/crypto/curve25519"
 )
 
+// Scheme selects how an Ed25519 private key is turned into an X25519 scalar.
+type Scheme uint8
+
+const (
+	// SchemeLibsodium uses the clamped SHA-512(seed)[:32], matching libsodium's
+	// crypto_sign_ed25519_sk_to_curve25519, age and RFC 8032 key expansion.
+	SchemeLibsodium Scheme = iota
+	// SchemeLegacy uses the raw Ed25519 seed as the scalar. Secrets derived
+	// this way only match peers running earlier versions of this package.
+	SchemeLegacy
+)
+
 type KeyPair struct {
 	PrivateKey []byte
 	PublicKey  []byte
 }
 
 func (kp *KeyPair) EcdhShare(peerPubKey []byte) ([]byte, error) {
+	return kp.DeriveShare(peerPubKey, KDFLegacySHA256)
+}
+
+// DeriveShare performs X25519 with the peer and passes the result through kdf.
+func (kp *KeyPair) DeriveShare(peerPubKey []byte, kdf KDF) ([]byte, error) {
 	sharedSecret, err := curve25519.X25519(kp.PrivateKey, peerPubKey)
 	if err != nil {
 		return nil, err
 	}
 
-	hashedSecret := sha256.Sum256(sharedSecret)
-	return hashedSecret[:], nil
+	return kdf.Derive(sharedSecret, kp.PublicKey, peerPubKey)
 }
 
+// GenerateKeyPair converts with SchemeLegacy and is kept for compatibility;
+// new code should use GenerateKeyPairWithScheme.
 func GenerateKeyPair(ed25519PrivKey ed25519.PrivateKey) (*KeyPair, error) {
 	privKey := ed25519PrivKey.Seed()
 	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
@@ -34,3 +53,38 @@ func GenerateKeyPair(ed25519PrivKey ed25519.PrivateKey) (*KeyPair, error) {
 		PublicKey:  pubKey[:],
 	}, nil
 }
+
+// GenerateKeyPairWithScheme converts an Ed25519 private key to an X25519 key
+// pair using the given scheme.
+func GenerateKeyPairWithScheme(ed25519PrivKey ed25519.PrivateKey, scheme Scheme) (*KeyPair, error) {
+	switch scheme {
+	case SchemeLibsodium:
+		return NewKeyPairFromEd25519(ed25519PrivKey)
+	case SchemeLegacy:
+		return GenerateKeyPair(ed25519PrivKey)
+	default:
+		return nil, fmt.Errorf("x25519: unsupported conversion scheme: %d", scheme)
+	}
+}
+
+// NewKeyPairFromEd25519 derives the X25519 key pair whose scalar is the
+// clamped SHA-512(seed)[:32] of the Ed25519 key, i.e. the same scalar the
+// Ed25519 public key was computed with. Its public key therefore equals
+// the birational map of the Ed25519 public key.
+func NewKeyPairFromEd25519(ed25519PrivKey ed25519.PrivateKey) (*KeyPair, error) {
+	h := sha512.Sum512(ed25519PrivKey.Seed())
+	privKey := h[:curve25519.ScalarSize]
+	privKey[0] &= 248
+	privKey[31] &= 127
+	privKey[31] |= 64
+
+	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+
+	return &KeyPair{
+		PrivateKey: privKey,
+		PublicKey:  pubKey,
+	}, nil
+}
@@ -0,0 +1,180 @@
+package x3dh
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/lyonnee/key25519"
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+)
+
+// curveType prefixes encoded X25519 public keys, as in libsignal.
+const curveType = 0x05
+
+var (
+	ErrInvalidBundle    = errors.New("x3dh: malformed prekey bundle")
+	ErrInvalidSignature = errors.New("x3dh: invalid signed prekey signature")
+	ErrInvalidMessage   = errors.New("x3dh: malformed initial message")
+	ErrPreKeyMismatch   = errors.New("x3dh: initial message does not match the given prekeys")
+)
+
+// encodeKey is Encode(PK) of the X3DH specification: the curve type byte
+// followed by the little-endian u-coordinate.
+func encodeKey(pubKey []byte) []byte {
+	return append([]byte{curveType}, pubKey...)
+}
+
+// SignedPreKey is a medium-term X25519 prekey signed by the identity key.
+type SignedPreKey struct {
+	ID        uint32
+	KeyPair   *x25519.KeyPair
+	Signature []byte
+}
+
+// OneTimePreKey is an X25519 prekey used for at most one session.
+type OneTimePreKey struct {
+	ID      uint32
+	KeyPair *x25519.KeyPair
+}
+
+// NewSignedPreKey generates a prekey and signs its encoding with the
+// identity's PrivateKey.SignMsg.
+func NewSignedPreKey(identity *key25519.KeyPair, id uint32, rand io.Reader) (*SignedPreKey, error) {
+	kp, err := generateKeyPair(rand)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedPreKey{
+		ID:        id,
+		KeyPair:   kp,
+		Signature: identity.PrivateKey().SignMsg(encodeKey(kp.PublicKey)),
+	}, nil
+}
+
+// NewOneTimePreKeys generates n one-time prekeys with consecutive ids
+// starting at startID.
+func NewOneTimePreKeys(startID uint32, n int, rand io.Reader) ([]*OneTimePreKey, error) {
+	keys := make([]*OneTimePreKey, 0, n)
+	for i := 0; i < n; i++ {
+		kp, err := generateKeyPair(rand)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, &OneTimePreKey{ID: startID + uint32(i), KeyPair: kp})
+	}
+	return keys, nil
+}
+
+// PreKeyBundle is what a server hands out to initiators: the responder's
+// identity key, its signed prekey and optionally one one-time prekey.
+type PreKeyBundle struct {
+	IdentityKey           key25519.PublicKey `json:"identityKey"`
+	SignedPreKeyID        uint32             `json:"signedPreKeyId"`
+	SignedPreKey          []byte             `json:"signedPreKey"`
+	SignedPreKeySignature []byte             `json:"signedPreKeySignature"`
+	OneTimePreKeyID       uint32             `json:"oneTimePreKeyId,omitempty"`
+	OneTimePreKey         []byte             `json:"oneTimePreKey,omitempty"`
+}
+
+// NewPreKeyBundle assembles the public part of the given prekeys. opk may be
+// nil when the responder has run out of one-time prekeys.
+func NewPreKeyBundle(identity key25519.PublicKey, spk *SignedPreKey, opk *OneTimePreKey) *PreKeyBundle {
+	b := &PreKeyBundle{
+		IdentityKey:           identity,
+		SignedPreKeyID:        spk.ID,
+		SignedPreKey:          append([]byte(nil), spk.KeyPair.PublicKey...),
+		SignedPreKeySignature: append([]byte(nil), spk.Signature...),
+	}
+	if opk != nil {
+		b.OneTimePreKeyID = opk.ID
+		b.OneTimePreKey = append([]byte(nil), opk.KeyPair.PublicKey...)
+	}
+	return b
+}
+
+// Verify checks the signed prekey signature with PublicKey.VerifyMsg.
+func (b *PreKeyBundle) Verify() error {
+	if len(b.SignedPreKey) != curve25519.PointSize {
+		return ErrInvalidBundle
+	}
+	if len(b.OneTimePreKey) != 0 && len(b.OneTimePreKey) != curve25519.PointSize {
+		return ErrInvalidBundle
+	}
+	if !b.IdentityKey.VerifyMsg(encodeKey(b.SignedPreKey), b.SignedPreKeySignature) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// MarshalBinary encodes the bundle as
+// identity(32) | spk id(4) | spk(32) | signature(64) | flag(1) [| opk id(4) | opk(32)].
+func (b *PreKeyBundle) MarshalBinary() ([]byte, error) {
+	if len(b.SignedPreKey) != curve25519.PointSize || len(b.SignedPreKeySignature) != signatureSize {
+		return nil, ErrInvalidBundle
+	}
+
+	out := make([]byte, 0, bundleSize+4+curve25519.PointSize)
+	out = append(out, b.IdentityKey[:]...)
+	out = binary.BigEndian.AppendUint32(out, b.SignedPreKeyID)
+	out = append(out, b.SignedPreKey...)
+	out = append(out, b.SignedPreKeySignature...)
+
+	switch len(b.OneTimePreKey) {
+	case 0:
+		out = append(out, 0)
+	case curve25519.PointSize:
+		out = append(out, 1)
+		out = binary.BigEndian.AppendUint32(out, b.OneTimePreKeyID)
+		out = append(out, b.OneTimePreKey...)
+	default:
+		return nil, ErrInvalidBundle
+	}
+	return out, nil
+}
+
+func (b *PreKeyBundle) UnmarshalBinary(data []byte) error {
+	if len(data) != bundleSize && len(data) != bundleSize+4+curve25519.PointSize {
+		return ErrInvalidBundle
+	}
+
+	var nb PreKeyBundle
+	copy(nb.IdentityKey[:], data)
+	data = data[key25519.PublicKeyLength:]
+	nb.SignedPreKeyID = binary.BigEndian.Uint32(data)
+	data = data[4:]
+	nb.SignedPreKey = append([]byte(nil), data[:curve25519.PointSize]...)
+	data = data[curve25519.PointSize:]
+	nb.SignedPreKeySignature = append([]byte(nil), data[:signatureSize]...)
+	data = data[signatureSize:]
+
+	switch {
+	case data[0] == 0 && len(data) == 1:
+	case data[0] == 1 && len(data) == 1+4+curve25519.PointSize:
+		nb.OneTimePreKeyID = binary.BigEndian.Uint32(data[1:])
+		nb.OneTimePreKey = append([]byte(nil), data[5:]...)
+	default:
+		return ErrInvalidBundle
+	}
+
+	*b = nb
+	return nil
+}
+
+const (
+	signatureSize = 64
+	bundleSize    = key25519.PublicKeyLength + 4 + curve25519.PointSize + signatureSize + 1
+)
+
+func generateKeyPair(rand io.Reader) (*x25519.KeyPair, error) {
+	privKey := make([]byte, curve25519.ScalarSize)
+	if _, err := io.ReadFull(rand, privKey); err != nil {
+		return nil, err
+	}
+	pubKey, err := curve25519.X25519(privKey, curve25519.Basepoint)
+	if err != nil {
+		return nil, err
+	}
+	return &x25519.KeyPair{PrivateKey: privKey, PublicKey: pubKey}, nil
+}
@@ -0,0 +1,202 @@
+// Package x3dh implements the Signal X3DH key agreement protocol
+// (https://signal.org/docs/specifications/x3dh/) with key25519 identity
+// keys. Identity keys sign prekeys as Ed25519 and take part in the DH steps
+// through their birationally equivalent X25519 keys.
+package x3dh
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+
+	"github.com/lyonnee/key25519"
+	"github.com/lyonnee/key25519/x25519"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// SharedSecretSize is the size of the derived secret SK.
+const SharedSecretSize = 32
+
+// Result is the outcome of the key agreement.
+type Result struct {
+	// SharedSecret is SK, to be used as the initial root key of a
+	// post-X3DH protocol such as the Double Ratchet.
+	SharedSecret []byte
+	// AssociatedData is Encode(IK_A) || Encode(IK_B), to be bound to every
+	// message of the session.
+	AssociatedData []byte
+}
+
+// InitialMessage is sent by the initiator so the responder can compute the
+// same secret.
+type InitialMessage struct {
+	IdentityKey     key25519.PublicKey `json:"identityKey"`
+	EphemeralKey    []byte             `json:"ephemeralKey"`
+	SignedPreKeyID  uint32             `json:"signedPreKeyId"`
+	OneTimePreKeyID uint32             `json:"oneTimePreKeyId,omitempty"`
+	// HasOneTimePreKey reports whether OneTimePreKeyID is meaningful.
+	HasOneTimePreKey bool `json:"hasOneTimePreKey"`
+}
+
+// Initiate verifies the responder's bundle and runs the initiator side of
+// X3DH. info identifies the application and must match on both sides.
+func Initiate(identity *key25519.KeyPair, bundle *PreKeyBundle, info []byte, rand io.Reader) (*Result, *InitialMessage, error) {
+	if err := bundle.Verify(); err != nil {
+		return nil, nil, err
+	}
+
+	ik, err := identity.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		return nil, nil, err
+	}
+	peerIK, err := bundle.IdentityKey.ToX25519()
+	if err != nil {
+		return nil, nil, err
+	}
+	ek, err := generateKeyPair(rand)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dhs := [][2][]byte{
+		{ik.PrivateKey, bundle.SignedPreKey},
+		{ek.PrivateKey, peerIK},
+		{ek.PrivateKey, bundle.SignedPreKey},
+	}
+	if len(bundle.OneTimePreKey) != 0 {
+		dhs = append(dhs, [2][]byte{ek.PrivateKey, bundle.OneTimePreKey})
+	}
+
+	sk, err := deriveSecret(dhs, info)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	msg := &InitialMessage{
+		IdentityKey:      identity.PublicKey(),
+		EphemeralKey:     ek.PublicKey,
+		SignedPreKeyID:   bundle.SignedPreKeyID,
+		OneTimePreKeyID:  bundle.OneTimePreKeyID,
+		HasOneTimePreKey: len(bundle.OneTimePreKey) != 0,
+	}
+	return &Result{
+		SharedSecret:   sk,
+		AssociatedData: associatedData(ik.PublicKey, peerIK),
+	}, msg, nil
+}
+
+// Respond runs the responder side of X3DH for an initial message, using the
+// signed prekey and, if the message names one, the one-time prekey it
+// refers to. The caller must delete the one-time prekey afterwards.
+func Respond(identity *key25519.KeyPair, spk *SignedPreKey, opk *OneTimePreKey, msg *InitialMessage, info []byte) (*Result, error) {
+	if len(msg.EphemeralKey) != curve25519.PointSize {
+		return nil, ErrInvalidMessage
+	}
+	if spk.ID != msg.SignedPreKeyID || msg.HasOneTimePreKey != (opk != nil) {
+		return nil, ErrPreKeyMismatch
+	}
+	if opk != nil && opk.ID != msg.OneTimePreKeyID {
+		return nil, ErrPreKeyMismatch
+	}
+
+	ik, err := identity.ExportEcdhKeyPairScheme(x25519.SchemeLibsodium)
+	if err != nil {
+		return nil, err
+	}
+	peerIK, err := msg.IdentityKey.ToX25519()
+	if err != nil {
+		return nil, err
+	}
+
+	dhs := [][2][]byte{
+		{spk.KeyPair.PrivateKey, peerIK},
+		{ik.PrivateKey, msg.EphemeralKey},
+		{spk.KeyPair.PrivateKey, msg.EphemeralKey},
+	}
+	if opk != nil {
+		dhs = append(dhs, [2][]byte{opk.KeyPair.PrivateKey, msg.EphemeralKey})
+	}
+
+	sk, err := deriveSecret(dhs, info)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		SharedSecret:   sk,
+		AssociatedData: associatedData(peerIK, ik.PublicKey),
+	}, nil
+}
+
+// MarshalBinary encodes the message as
+// identity(32) | ephemeral(32) | spk id(4) | flag(1) [| opk id(4)].
+func (m *InitialMessage) MarshalBinary() ([]byte, error) {
+	if len(m.EphemeralKey) != curve25519.PointSize {
+		return nil, ErrInvalidMessage
+	}
+
+	out := make([]byte, 0, messageSize+4)
+	out = append(out, m.IdentityKey[:]...)
+	out = append(out, m.EphemeralKey...)
+	out = binary.BigEndian.AppendUint32(out, m.SignedPreKeyID)
+	if m.HasOneTimePreKey {
+		out = append(out, 1)
+		out = binary.BigEndian.AppendUint32(out, m.OneTimePreKeyID)
+	} else {
+		out = append(out, 0)
+	}
+	return out, nil
+}
+
+func (m *InitialMessage) UnmarshalBinary(data []byte) error {
+	if len(data) != messageSize && len(data) != messageSize+4 {
+		return ErrInvalidMessage
+	}
+
+	var nm InitialMessage
+	copy(nm.IdentityKey[:], data)
+	data = data[key25519.PublicKeyLength:]
+	nm.EphemeralKey = append([]byte(nil), data[:curve25519.PointSize]...)
+	data = data[curve25519.PointSize:]
+	nm.SignedPreKeyID = binary.BigEndian.Uint32(data)
+	data = data[4:]
+
+	switch {
+	case data[0] == 0 && len(data) == 1:
+	case data[0] == 1 && len(data) == 5:
+		nm.HasOneTimePreKey = true
+		nm.OneTimePreKeyID = binary.BigEndian.Uint32(data[1:])
+	default:
+		return ErrInvalidMessage
+	}
+
+	*m = nm
+	return nil
+}
+
+const messageSize = key25519.PublicKeyLength + curve25519.PointSize + 4 + 1
+
+// deriveSecret computes SK = HKDF(F || DH1 || ... || DHn) where F is 32 0xFF
+// bytes, the salt is all zeros and info names the application.
+func deriveSecret(dhs [][2][]byte, info []byte) ([]byte, error) {
+	ikm := bytes.Repeat([]byte{0xFF}, 32)
+	for _, dh := range dhs {
+		out, err := curve25519.X25519(dh[0], dh[1])
+		if err != nil {
+			return nil, err
+		}
+		ikm = append(ikm, out...)
+	}
+
+	sk := make([]byte, SharedSecretSize)
+	salt := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, ikm, salt, info), sk); err != nil {
+		return nil, err
+	}
+	return sk, nil
+}
+
+func associatedData(initiatorIK, responderIK []byte) []byte {
+	return append(encodeKey(initiatorIK), encodeKey(responderIK)...)
+}
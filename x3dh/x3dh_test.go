@@ -0,0 +1,126 @@
+package x3dh
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/lyonnee/key25519"
+)
+
+var testInfo = []byte("key25519 x3dh test")
+
+type responder struct {
+	identity *key25519.KeyPair
+	spk      *SignedPreKey
+	opks     []*OneTimePreKey
+}
+
+func newResponder(t *testing.T) *responder {
+	t.Helper()
+	identity := key25519.NewKeyPair()
+	spk, err := NewSignedPreKey(identity, 1, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opks, err := NewOneTimePreKeys(100, 2, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &responder{identity, spk, opks}
+}
+
+// roundTrip sends the bundle through its binary encoding, runs both sides
+// and checks that they agree.
+func roundTrip(t *testing.T, bob *responder, opk *OneTimePreKey) *InitialMessage {
+	t.Helper()
+	alice := key25519.NewKeyPair()
+
+	bundleBytes, err := NewPreKeyBundle(bob.identity.PublicKey(), bob.spk, opk).MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var bundle PreKeyBundle
+	if err := bundle.UnmarshalBinary(bundleBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	ra, msg, err := Initiate(alice, &bundle, testInfo, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msgBytes, err := msg.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received InitialMessage
+	if err := received.UnmarshalBinary(msgBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	rb, err := Respond(bob.identity, bob.spk, opk, &received, testInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ra.SharedSecret) != SharedSecretSize || !bytes.Equal(ra.SharedSecret, rb.SharedSecret) {
+		t.Fatal("shared secrets differ")
+	}
+	if !bytes.Equal(ra.AssociatedData, rb.AssociatedData) {
+		t.Fatal("associated data differs")
+	}
+	return &received
+}
+
+func TestRoundTripWithOneTimePreKey(t *testing.T) {
+	bob := newResponder(t)
+	msg := roundTrip(t, bob, bob.opks[0])
+	if !msg.HasOneTimePreKey || msg.OneTimePreKeyID != bob.opks[0].ID {
+		t.Fatalf("initial message names one-time prekey %v/%d", msg.HasOneTimePreKey, msg.OneTimePreKeyID)
+	}
+}
+
+func TestRoundTripWithoutOneTimePreKey(t *testing.T) {
+	bob := newResponder(t)
+	msg := roundTrip(t, bob, nil)
+	if msg.HasOneTimePreKey {
+		t.Fatal("initial message names a one-time prekey")
+	}
+}
+
+func TestRespondPreKeyMismatch(t *testing.T) {
+	bob := newResponder(t)
+	alice := key25519.NewKeyPair()
+
+	_, msg, err := Initiate(alice, NewPreKeyBundle(bob.identity.PublicKey(), bob.spk, bob.opks[0]), testInfo, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Respond(bob.identity, bob.spk, nil, msg, testInfo); err != ErrPreKeyMismatch {
+		t.Fatalf("missing one-time prekey: err = %v, want ErrPreKeyMismatch", err)
+	}
+	if _, err := Respond(bob.identity, bob.spk, bob.opks[1], msg, testInfo); err != ErrPreKeyMismatch {
+		t.Fatalf("wrong one-time prekey: err = %v, want ErrPreKeyMismatch", err)
+	}
+}
+
+func TestBadSignedPreKeySignature(t *testing.T) {
+	bob := newResponder(t)
+	alice := key25519.NewKeyPair()
+
+	tampered := NewPreKeyBundle(bob.identity.PublicKey(), bob.spk, nil)
+	tampered.SignedPreKeySignature[0] ^= 1
+	if _, _, err := Initiate(alice, tampered, testInfo, rand.Reader); err != ErrInvalidSignature {
+		t.Fatalf("tampered signature: err = %v, want ErrInvalidSignature", err)
+	}
+
+	// A prekey signed by a different identity must be rejected too.
+	mallory := key25519.NewKeyPair()
+	forged, err := NewSignedPreKey(mallory, 1, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Initiate(alice, NewPreKeyBundle(bob.identity.PublicKey(), forged, nil), testInfo, rand.Reader); err != ErrInvalidSignature {
+		t.Fatalf("foreign signature: err = %v, want ErrInvalidSignature", err)
+	}
+}